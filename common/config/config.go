@@ -17,9 +17,13 @@ var ServerAddress = "http://localhost:3000"
 var Footer = ""
 var Logo = ""
 var TopUpLink = ""
+var PaymentProvider = "" // stripe or generic, empty means online payment is disabled
+var PaymentCurrency = "usd"
+var PaymentMinTopUp = 1.0 // in PaymentCurrency
 var ChatLink = ""
 var QuotaPerUnit = 500 * 1000.0 // $0.002 / 1K tokens
 var DisplayInCurrencyEnabled = true
+var DisplayCurrency = "USD" // for users without a display currency of their own
 var DisplayTokenStatEnabled = true
 
 // Any options with "Secret", "Token" in its key won't be return by GetOptions
@@ -89,9 +93,20 @@ var MessagePusherToken = ""
 var TurnstileSiteKey = ""
 var TurnstileSecretKey = ""
 
+var StripeApiAddress = "https://api.stripe.com"
+var StripeApiSecret = ""
+var StripeWebhookSecret = ""
+
+var GenericPaymentAddress = ""
+var GenericPaymentSecret = ""
+
 var QuotaForNewUser int64 = 0
 var QuotaForInviter int64 = 0
 var QuotaForInvitee int64 = 0
+var ReferralCommissionEnabled = false
+var ReferralCommissionRate = 0.0              // percentage of the invitee's consumed quota
+var ReferralCommissionCapPerInvitee int64 = 0 // 0 means no cap
+var ReferralCommissionMinSpend int64 = 0      // invitees earn commission only after spending this much in total
 var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
@@ -114,6 +129,16 @@ var BatchUpdateInterval = env.Int("BATCH_UPDATE_INTERVAL", 5)
 
 var RelayTimeout = env.Int("RELAY_TIMEOUT", 0) // unit is second
 
+var QuotaReconcileFrequency = env.Int("QUOTA_RECONCILE_FREQUENCY", 0) // unit is minute
+var QuotaReconcileAutoFixEnabled = env.Bool("QUOTA_RECONCILE_AUTO_FIX", false)
+var QuotaReconcileTolerance = env.Int("QUOTA_RECONCILE_TOLERANCE", 5000)
+
+var PlanGrantFrequency = env.Int("PLAN_GRANT_FREQUENCY", 60) // unit is second
+
+var ReferralSettleFrequency = env.Int("REFERRAL_SETTLE_FREQUENCY", 60) // unit is minute
+
+var MonthlyStatementFrequency = env.Int("MONTHLY_STATEMENT_FREQUENCY", 60) // unit is minute
+
 var GeminiSafetySetting = env.String("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
 
 var Theme = env.String("THEME", "default")
@@ -152,6 +177,12 @@ var MetricFailChanSize = env.Int("METRIC_FAIL_CHAN_SIZE", 128)
 
 var InitialRootToken = os.Getenv("INITIAL_ROOT_TOKEN")
 
+// TokenKeyPepper is mixed into the hashes of token keys, changing it invalidates all tokens
+var TokenKeyPepper = env.String("TOKEN_KEY_PEPPER", "")
+
+// TokenRotationGracePeriod is how long the previous key of a rotated token keeps working by default, in seconds
+var TokenRotationGracePeriod = env.Int("TOKEN_ROTATION_GRACE_PERIOD", 24*60*60)
+
 var InitialRootAccessToken = os.Getenv("INITIAL_ROOT_ACCESS_TOKEN")
 
 var GeminiVersion = env.String("GEMINI_VERSION", "v1")
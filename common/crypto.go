@@ -1,6 +1,14 @@
 package common
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
 
 func Password2Hash(password string) (string, error) {
 	passwordBytes := []byte(password)
@@ -12,3 +20,11 @@ func ValidatePasswordAndHash(password string, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// HashTokenKey is what is stored for a token key. Keys are random, so unlike
+// passwords they are not salted, which keeps the lookup a single indexed query.
+func HashTokenKey(key string) string {
+	mac := hmac.New(sha256.New, []byte(config.TokenKeyPepper))
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
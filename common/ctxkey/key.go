@@ -1,24 +1,36 @@
 package ctxkey
 
 const (
-	Config            = "config"
-	Id                = "id"
-	Username          = "username"
-	Role              = "role"
-	Status            = "status"
-	Channel           = "channel"
-	ChannelId         = "channel_id"
-	SpecificChannelId = "specific_channel_id"
-	RequestModel      = "request_model"
-	ConvertedRequest  = "converted_request"
-	OriginalModel     = "original_model"
-	Group             = "group"
-	ModelMapping      = "model_mapping"
-	ChannelName       = "channel_name"
-	TokenId           = "token_id"
-	TokenName         = "token_name"
-	BaseURL           = "base_url"
-	AvailableModels   = "available_models"
-	KeyRequestBody    = "key_request_body"
-	SystemPrompt      = "system_prompt"
+	Config                = "config"
+	Id                    = "id"
+	Username              = "username"
+	Role                  = "role"
+	Status                = "status"
+	Channel               = "channel"
+	ChannelId             = "channel_id"
+	SpecificChannelId     = "specific_channel_id"
+	RequestModel          = "request_model"
+	ConvertedRequest      = "converted_request"
+	OriginalModel         = "original_model"
+	Group                 = "group"
+	ModelMapping          = "model_mapping"
+	ChannelName           = "channel_name"
+	TokenId               = "token_id"
+	TokenName             = "token_name"
+	BaseURL               = "base_url"
+	AvailableModels       = "available_models"
+	KeyRequestBody        = "key_request_body"
+	SystemPrompt          = "system_prompt"
+	CostHeaders           = "cost_headers"
+	TokenRateLimit        = "token_rate_limit"
+	TokenModelMapping     = "token_model_mapping"
+	TokenSystemPrompt     = "token_system_prompt"
+	TokenSystemPromptMode = "token_system_prompt_mode"
+	EndUser               = "end_user"
+	TokenEndUserRateLimit = "token_end_user_rate_limit"
+	TokenEndUserQuota     = "token_end_user_quota"
+	TokenLimitId          = "token_limit_id"
+	OrganizationId        = "organization_id"
+	OrganizationRole      = "organization_role"
+	OrganizationMemberId  = "organization_member_id"
 )
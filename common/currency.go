@@ -0,0 +1,131 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Currency is used to display quota, Rate is the amount of the currency per USD.
+type Currency struct {
+	Rate   float64 `json:"rate"`
+	Symbol string  `json:"symbol"`
+}
+
+var currenciesLock sync.RWMutex
+var Currencies = map[string]Currency{
+	"USD": {Rate: 1, Symbol: "$"},
+	"CNY": {Rate: 7.2, Symbol: "¥"},
+	"EUR": {Rate: 0.92, Symbol: "€"},
+}
+
+func Currencies2JSONString() string {
+	currenciesLock.RLock()
+	defer currenciesLock.RUnlock()
+	jsonBytes, err := json.Marshal(Currencies)
+	if err != nil {
+		logger.SysError("error marshalling currencies: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func parseCurrencies(jsonStr string) (map[string]Currency, error) {
+	var parsed map[string]Currency
+	err := json.Unmarshal([]byte(jsonStr), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("currencies must be an object of currency code to rate and symbol: %s", err.Error())
+	}
+	// codes are kept upper case, lookups normalize the code the same way
+	currencies := make(map[string]Currency, len(parsed))
+	for code, currency := range parsed {
+		if currency.Rate <= 0 {
+			return nil, fmt.Errorf("rate of currency %s must be positive", code)
+		}
+		currencies[NormalizeCurrency(code)] = currency
+	}
+	return currencies, nil
+}
+
+func ValidateCurrenciesJSONString(jsonStr string) error {
+	_, err := parseCurrencies(jsonStr)
+	return err
+}
+
+func UpdateCurrenciesByJSONString(jsonStr string) error {
+	currencies, err := parseCurrencies(jsonStr)
+	if err != nil {
+		return err
+	}
+	currenciesLock.Lock()
+	defer currenciesLock.Unlock()
+	Currencies = currencies
+	return nil
+}
+
+func GetCurrencies() map[string]Currency {
+	currenciesLock.RLock()
+	defer currenciesLock.RUnlock()
+	currencies := make(map[string]Currency, len(Currencies))
+	for code, currency := range Currencies {
+		currencies[code] = currency
+	}
+	return currencies
+}
+
+// NormalizeCurrency returns the form currency codes are stored and looked up in.
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func IsValidCurrency(code string) bool {
+	currenciesLock.RLock()
+	defer currenciesLock.RUnlock()
+	_, ok := Currencies[NormalizeCurrency(code)]
+	return ok
+}
+
+// GetCurrencyRate returns the rate of a currency in the table, unlike GetCurrency
+// there is no fallback, so amounts paid in it are never converted at a wrong rate.
+func GetCurrencyRate(code string) (float64, bool) {
+	currenciesLock.RLock()
+	defer currenciesLock.RUnlock()
+	currency, ok := Currencies[NormalizeCurrency(code)]
+	return currency.Rate, ok
+}
+
+// GetCurrency resolves the display currency of a user, an empty or unknown
+// code falls back to config.DisplayCurrency and then to USD.
+func GetCurrency(code string) (string, Currency) {
+	currenciesLock.RLock()
+	defer currenciesLock.RUnlock()
+	for _, c := range []string{code, config.DisplayCurrency} {
+		c = NormalizeCurrency(c)
+		if currency, ok := Currencies[c]; ok {
+			return c, currency
+		}
+	}
+	return "USD", Currency{Rate: 1, Symbol: "$"}
+}
+
+// QuotaToCurrency converts quota to the amount in a currency, quota is
+// returned as is when DisplayInCurrencyEnabled is off.
+func QuotaToCurrency(quota int64, code string) float64 {
+	if !config.DisplayInCurrencyEnabled {
+		return float64(quota)
+	}
+	_, currency := GetCurrency(code)
+	return float64(quota) / config.QuotaPerUnit * currency.Rate
+}
+
+// FormatQuota is like LogQuota but in the given currency.
+func FormatQuota(quota int64, code string) string {
+	if !config.DisplayInCurrencyEnabled {
+		return fmt.Sprintf("%d 点额度", quota)
+	}
+	_, currency := GetCurrency(code)
+	return fmt.Sprintf("%s%.2f", currency.Symbol, QuotaToCurrency(quota, code))
+}
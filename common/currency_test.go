@@ -0,0 +1,67 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestCurrency(t *testing.T) {
+	defer func(currencies map[string]Currency) { Currencies = currencies }(Currencies)
+	err := UpdateCurrenciesByJSONString(`{"usd": {"rate": 1, "symbol": "$"}, "CNY": {"rate": 7, "symbol": "¥"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.DisplayCurrency = "cny"
+	defer func() { config.DisplayCurrency = "USD" }()
+
+	Convey("GetCurrency", t, func() {
+		tests := []struct {
+			code string
+			want string
+			rate float64
+		}{
+			{"CNY", "CNY", 7},
+			{"cny", "CNY", 7},
+			{" Usd ", "USD", 1},
+			{"", "CNY", 7},
+			{"JPY", "CNY", 7},
+		}
+		for _, tt := range tests {
+			code, currency := GetCurrency(tt.code)
+			So(code, ShouldEqual, tt.want)
+			So(currency.Rate, ShouldEqual, tt.rate)
+		}
+	})
+	Convey("GetCurrency falls back to USD", t, func() {
+		config.DisplayCurrency = "JPY"
+		defer func() { config.DisplayCurrency = "cny" }()
+		code, currency := GetCurrency("")
+		So(code, ShouldEqual, "USD")
+		So(currency.Rate, ShouldEqual, 1)
+	})
+	Convey("GetCurrencyRate has no fallback", t, func() {
+		rate, ok := GetCurrencyRate("usd")
+		So(ok, ShouldBeTrue)
+		So(rate, ShouldEqual, 1)
+		_, ok = GetCurrencyRate("JPY")
+		So(ok, ShouldBeFalse)
+	})
+	Convey("QuotaToCurrency", t, func() {
+		config.DisplayInCurrencyEnabled = true
+		So(QuotaToCurrency(int64(config.QuotaPerUnit), "cny"), ShouldEqual, 7)
+		So(QuotaToCurrency(int64(config.QuotaPerUnit)/2, "USD"), ShouldEqual, 0.5)
+		So(FormatQuota(int64(config.QuotaPerUnit), "CNY"), ShouldEqual, "¥7.00")
+		config.DisplayInCurrencyEnabled = false
+		defer func() { config.DisplayInCurrencyEnabled = true }()
+		So(QuotaToCurrency(1000, "CNY"), ShouldEqual, 1000)
+		So(FormatQuota(1000, "CNY"), ShouldEqual, "1000 点额度")
+	})
+	Convey("rates must be positive", t, func() {
+		So(ValidateCurrenciesJSONString(`{"USD": {"rate": 0, "symbol": "$"}}`), ShouldNotBeNil)
+		So(IsValidCurrency("usd"), ShouldBeTrue)
+		So(IsValidCurrency("JPY"), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,116 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// Generic talks to any payment service implementing this small protocol:
+// checkouts are created by posting genericCheckoutRequest to GenericPaymentAddress,
+// and results are posted back as genericWebhook. Both directions are signed
+// with GenericPaymentSecret in the X-Timestamp and X-Signature headers.
+type Generic struct{}
+
+type genericCheckoutRequest struct {
+	TradeNo   string `json:"trade_no"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Title     string `json:"title"`
+	NotifyURL string `json:"notify_url"`
+	ReturnURL string `json:"return_url"`
+}
+
+type genericCheckoutResponse struct {
+	CheckoutURL string `json:"checkout_url"`
+	OrderId     string `json:"order_id"`
+	Message     string `json:"message"`
+}
+
+type genericWebhook struct {
+	TradeNo  string `json:"trade_no"`
+	OrderId  string `json:"order_id"`
+	Status   string `json:"status"` // paid or failed
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func (g *Generic) Name() string {
+	return ProviderGeneric
+}
+
+func (g *Generic) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	if config.GenericPaymentAddress == "" {
+		return nil, fmt.Errorf("payment address is not set")
+	}
+	data, err := json.Marshal(genericCheckoutRequest{
+		TradeNo:   req.TradeNo,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Title:     req.Title,
+		NotifyURL: req.NotifyURL,
+		ReturnURL: req.ReturnURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, config.GenericPaymentAddress, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Timestamp", timestamp)
+	httpReq.Header.Set("X-Signature", sign(config.GenericPaymentSecret, timestamp, data))
+	resp, err := client.ImpatientHTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var checkoutResp genericCheckoutResponse
+	err = json.NewDecoder(resp.Body).Decode(&checkoutResp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || checkoutResp.CheckoutURL == "" {
+		return nil, fmt.Errorf("failed to create checkout: status code %d, %s", resp.StatusCode, checkoutResp.Message)
+	}
+	return &Checkout{
+		URL:             checkoutResp.CheckoutURL,
+		ProviderOrderId: checkoutResp.OrderId,
+	}, nil
+}
+
+func (g *Generic) ParseWebhook(header http.Header, body []byte) (*Event, error) {
+	err := verifySignature(config.GenericPaymentSecret, header.Get("X-Timestamp"), body, []string{header.Get("X-Signature")})
+	if err != nil {
+		return nil, err
+	}
+	var webhook genericWebhook
+	err = json.Unmarshal(body, &webhook)
+	if err != nil {
+		return nil, err
+	}
+	event := &Event{
+		TradeNo:         webhook.TradeNo,
+		ProviderOrderId: webhook.OrderId,
+		Amount:          webhook.Amount,
+		Currency:        webhook.Currency,
+	}
+	switch webhook.Status {
+	case EventPaid:
+		event.Type = EventPaid
+	case EventFailed:
+		event.Type = EventFailed
+	default:
+		return nil, nil
+	}
+	return event, nil
+}
@@ -0,0 +1,117 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ProviderStripe  = "stripe"
+	ProviderGeneric = "generic"
+)
+
+const (
+	EventPaid   = "paid"
+	EventFailed = "failed"
+)
+
+// signatureTolerance is how old a signed webhook may be, to limit replays
+const signatureTolerance = 5 * time.Minute
+
+// currencies whose smallest unit is not a hundredth, ISO 4217 codes in lower case
+var minorUnitExponents = map[string]int{
+	"bif": 0, "clp": 0, "djf": 0, "gnf": 0, "isk": 0, "jpy": 0, "kmf": 0, "krw": 0,
+	"pyg": 0, "rwf": 0, "ugx": 0, "vnd": 0, "vuv": 0, "xaf": 0, "xof": 0, "xpf": 0,
+	"bhd": 3, "jod": 3, "kwd": 3, "omr": 3, "tnd": 3,
+}
+
+// MinorUnitExponent is the number of decimals of a currency, e.g. 2 for USD and 0 for JPY.
+func MinorUnitExponent(currency string) int {
+	if exponent, ok := minorUnitExponents[strings.ToLower(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// ToMinorUnits converts an amount to the smallest unit of the currency, as providers expect it.
+func ToMinorUnits(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(MinorUnitExponent(currency))))
+}
+
+type CheckoutRequest struct {
+	TradeNo   string
+	Amount    int64 // in the smallest currency unit, e.g. cents
+	Currency  string
+	Title     string
+	NotifyURL string
+	ReturnURL string
+}
+
+type Checkout struct {
+	URL             string
+	ProviderOrderId string
+}
+
+type Event struct {
+	Type            string
+	TradeNo         string
+	ProviderOrderId string
+	Amount          int64
+	Currency        string
+}
+
+type Provider interface {
+	Name() string
+	CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error)
+	// ParseWebhook verifies the signature of a webhook and returns its event,
+	// a nil event means the webhook is not about a payment and can be ignored.
+	ParseWebhook(header http.Header, body []byte) (*Event, error)
+}
+
+func GetProvider(name string) (Provider, error) {
+	switch name {
+	case ProviderStripe:
+		return &Stripe{}, nil
+	case ProviderGeneric:
+		return &Generic{}, nil
+	}
+	return nil, fmt.Errorf("unknown payment provider: %s", name)
+}
+
+// sign is the scheme of Stripe signatures: HMAC-SHA256 of "timestamp.body".
+func sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifySignature(secret string, timestamp string, body []byte, signatures []string) error {
+	if secret == "" {
+		return fmt.Errorf("webhook secret is not set")
+	}
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp")
+	}
+	age := time.Since(time.Unix(t, 0))
+	if age > signatureTolerance || age < -signatureTolerance {
+		return fmt.Errorf("signature timestamp is out of tolerance")
+	}
+	expected := []byte(sign(secret, timestamp, body))
+	for _, signature := range signatures {
+		if hmac.Equal(expected, []byte(signature)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature mismatch")
+}
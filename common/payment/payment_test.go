@@ -0,0 +1,66 @@
+package payment
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestStripeWebhook(t *testing.T) {
+	config.StripeWebhookSecret = "whsec_test"
+	body := []byte(`{"type":"checkout.session.completed","data":{"object":{"id":"cs_1","client_reference_id":"trade1","amount_total":1000,"currency":"usd","payment_status":"paid"}}}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	stripe := &Stripe{}
+	Convey("TestStripeWebhook", t, func() {
+		header := http.Header{}
+		header.Set("Stripe-Signature", "t="+timestamp+",v1=bad,v1="+sign(config.StripeWebhookSecret, timestamp, body))
+		event, err := stripe.ParseWebhook(header, body)
+		So(err, ShouldBeNil)
+		So(event.Type, ShouldEqual, EventPaid)
+		So(event.TradeNo, ShouldEqual, "trade1")
+		So(event.Amount, ShouldEqual, 1000)
+
+		header.Set("Stripe-Signature", "t="+timestamp+",v1="+sign("other", timestamp, body))
+		_, err = stripe.ParseWebhook(header, body)
+		So(err, ShouldNotBeNil)
+
+		old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+		header.Set("Stripe-Signature", "t="+old+",v1="+sign(config.StripeWebhookSecret, old, body))
+		_, err = stripe.ParseWebhook(header, body)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestGenericWebhook(t *testing.T) {
+	config.GenericPaymentSecret = "secret"
+	body := []byte(`{"trade_no":"trade1","order_id":"o1","status":"failed","amount":500,"currency":"usd"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	generic := &Generic{}
+	Convey("TestGenericWebhook", t, func() {
+		header := http.Header{}
+		header.Set("X-Timestamp", timestamp)
+		header.Set("X-Signature", sign(config.GenericPaymentSecret, timestamp, body))
+		event, err := generic.ParseWebhook(header, body)
+		So(err, ShouldBeNil)
+		So(event.Type, ShouldEqual, EventFailed)
+		So(event.ProviderOrderId, ShouldEqual, "o1")
+
+		_, err = generic.ParseWebhook(header, append(body, ' '))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestToMinorUnits(t *testing.T) {
+	Convey("TestToMinorUnits", t, func() {
+		So(ToMinorUnits(10.5, "usd"), ShouldEqual, 1050)
+		So(ToMinorUnits(0.29, "USD"), ShouldEqual, 29)
+		So(ToMinorUnits(1000, "jpy"), ShouldEqual, 1000)
+		So(ToMinorUnits(5000, "krw"), ShouldEqual, 5000)
+		So(ToMinorUnits(1.234, "kwd"), ShouldEqual, 1234)
+	})
+}
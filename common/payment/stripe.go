@@ -0,0 +1,142 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// Stripe uses Checkout Sessions, StripeApiAddress can point to any service
+// speaking the same API.
+type Stripe struct{}
+
+type stripeSession struct {
+	Id                string `json:"id"`
+	URL               string `json:"url"`
+	ClientReferenceId string `json:"client_reference_id"`
+	AmountTotal       int64  `json:"amount_total"`
+	Currency          string `json:"currency"`
+	PaymentStatus     string `json:"payment_status"`
+}
+
+type stripeError struct {
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type stripeEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		Object stripeSession `json:"object"`
+	} `json:"data"`
+}
+
+func (s *Stripe) Name() string {
+	return ProviderStripe
+}
+
+func (s *Stripe) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*Checkout, error) {
+	if config.StripeApiSecret == "" {
+		return nil, fmt.Errorf("stripe api secret is not set")
+	}
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("client_reference_id", req.TradeNo)
+	form.Set("success_url", req.ReturnURL)
+	form.Set("cancel_url", req.ReturnURL)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", req.Currency)
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(req.Amount, 10))
+	form.Set("line_items[0][price_data][product_data][name]", req.Title)
+	form.Set("metadata[trade_no]", req.TradeNo)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(config.StripeApiAddress, "/")+"/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+config.StripeApiSecret)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Idempotency-Key", req.TradeNo)
+	resp, err := client.ImpatientHTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var stripeErr stripeError
+		_ = json.NewDecoder(resp.Body).Decode(&stripeErr)
+		if stripeErr.Error != nil {
+			return nil, fmt.Errorf("stripe: %s", stripeErr.Error.Message)
+		}
+		return nil, fmt.Errorf("stripe: unexpected status code %d", resp.StatusCode)
+	}
+	var session stripeSession
+	err = json.NewDecoder(resp.Body).Decode(&session)
+	if err != nil {
+		return nil, err
+	}
+	return &Checkout{
+		URL:             session.URL,
+		ProviderOrderId: session.Id,
+	}, nil
+}
+
+// parseStripeSignature reads a Stripe-Signature header like "t=1492774577,v1=5257a869...".
+func parseStripeSignature(header string) (timestamp string, signatures []string) {
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	return timestamp, signatures
+}
+
+func (s *Stripe) ParseWebhook(header http.Header, body []byte) (*Event, error) {
+	timestamp, signatures := parseStripeSignature(header.Get("Stripe-Signature"))
+	err := verifySignature(config.StripeWebhookSecret, timestamp, body, signatures)
+	if err != nil {
+		return nil, err
+	}
+	var stripeEvent stripeEvent
+	err = json.Unmarshal(body, &stripeEvent)
+	if err != nil {
+		return nil, err
+	}
+	session := stripeEvent.Data.Object
+	event := &Event{
+		TradeNo:         session.ClientReferenceId,
+		ProviderOrderId: session.Id,
+		Amount:          session.AmountTotal,
+		Currency:        session.Currency,
+	}
+	switch stripeEvent.Type {
+	case "checkout.session.completed":
+		// delayed payment methods complete the session before the payment succeeds
+		if session.PaymentStatus != "paid" {
+			return nil, nil
+		}
+		event.Type = EventPaid
+	case "checkout.session.async_payment_succeeded":
+		event.Type = EventPaid
+	case "checkout.session.async_payment_failed", "checkout.session.expired":
+		event.Type = EventFailed
+	default:
+		return nil, nil
+	}
+	return event, nil
+}
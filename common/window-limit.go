@@ -0,0 +1,224 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WindowLimit allows at most Limit in any Window (seconds) for Key, a request
+// counts as Amount, e.g. 1 for requests or the prompt tokens for tokens.
+// Windows slide by weighting the previous fixed window by the part of it
+// that still overlaps the sliding one.
+type WindowLimit struct {
+	Key    string
+	Limit  int64
+	Amount int64
+	Window int64
+}
+
+// WindowLimitResult is the usage of a limit in the current window, including
+// the request if it was allowed, and when the current fixed window ends.
+type WindowLimitResult struct {
+	Used  int64
+	Reset time.Duration
+}
+
+// the limits are only consumed if all of them allow the request
+var windowLimitScript = `
+local allowed = 1
+local used = {}
+for i = 1, #KEYS / 2 do
+	local limit = tonumber(ARGV[i * 4 - 3])
+	local amount = tonumber(ARGV[i * 4 - 2])
+	local weight = tonumber(ARGV[i * 4 - 1])
+	local current = tonumber(redis.call('GET', KEYS[i * 2 - 1]) or '0')
+	local previous = tonumber(redis.call('GET', KEYS[i * 2]) or '0')
+	used[i] = math.floor(previous * weight) + current
+	if used[i] + amount > limit then
+		allowed = 0
+	end
+end
+if allowed == 1 then
+	for i = 1, #KEYS / 2 do
+		local amount = tonumber(ARGV[i * 4 - 2])
+		redis.call('INCRBY', KEYS[i * 2 - 1], amount)
+		redis.call('EXPIRE', KEYS[i * 2 - 1], tonumber(ARGV[i * 4]))
+		used[i] = used[i] + amount
+	end
+end
+table.insert(used, 1, allowed)
+return used
+`
+
+type windowState struct {
+	weight   float64 // of the previous window
+	reset    time.Duration
+	current  string
+	previous string
+}
+
+func getWindowState(limit *WindowLimit, now time.Time) windowState {
+	windowMs := limit.Window * 1000
+	nowMs := now.UnixMilli()
+	index := nowMs / windowMs
+	elapsed := nowMs % windowMs
+	return windowState{
+		weight:   1 - float64(elapsed)/float64(windowMs),
+		reset:    time.Duration(windowMs-elapsed) * time.Millisecond,
+		current:  fmt.Sprintf("windowLimit:%s:%d", limit.Key, index),
+		previous: fmt.Sprintf("windowLimit:%s:%d", limit.Key, index-1),
+	}
+}
+
+// WindowLimitRequest checks and consumes the limits in Redis if it is
+// enabled, or in memory otherwise.
+func WindowLimitRequest(ctx context.Context, limits []WindowLimit) (bool, []WindowLimitResult, error) {
+	now := time.Now()
+	states := make([]windowState, len(limits))
+	for i := range limits {
+		states[i] = getWindowState(&limits[i], now)
+	}
+	if !RedisEnabled {
+		return inMemoryWindowLimiter.request(limits, states, now)
+	}
+	keys := make([]string, 0, len(limits)*2)
+	args := make([]interface{}, 0, len(limits)*4)
+	for i, limit := range limits {
+		keys = append(keys, states[i].current, states[i].previous)
+		args = append(args, limit.Limit, limit.Amount, states[i].weight, limit.Window*2)
+	}
+	values, err := RDB.Eval(ctx, windowLimitScript, keys, args...).Int64Slice()
+	if err != nil {
+		return false, nil, err
+	}
+	results := make([]WindowLimitResult, len(limits))
+	for i := range limits {
+		results[i] = WindowLimitResult{Used: values[i+1], Reset: states[i].reset}
+	}
+	return values[0] == 1, results, nil
+}
+
+// WindowLimitUsage returns the usage of a limit without consuming it.
+func WindowLimitUsage(ctx context.Context, limit WindowLimit) (int64, error) {
+	state := getWindowState(&limit, time.Now())
+	if !RedisEnabled {
+		return inMemoryWindowLimiter.usage(state), nil
+	}
+	values, err := RDB.MGet(ctx, state.current, state.previous).Result()
+	if err != nil {
+		return 0, err
+	}
+	counts := make([]int64, len(values))
+	for i, value := range values {
+		if str, ok := value.(string); ok {
+			counts[i], _ = strconv.ParseInt(str, 10, 64)
+		}
+	}
+	return int64(float64(counts[1])*state.weight) + counts[0], nil
+}
+
+// WindowLimitAdd adds Amount to the usage of a limit without checking it, for
+// usage that is only known after the request, e.g. the quota it consumed.
+func WindowLimitAdd(ctx context.Context, limit WindowLimit) error {
+	now := time.Now()
+	state := getWindowState(&limit, now)
+	if !RedisEnabled {
+		inMemoryWindowLimiter.add(&limit, state, now)
+		return nil
+	}
+	pipe := RDB.TxPipeline()
+	pipe.IncrBy(ctx, state.current, limit.Amount)
+	pipe.Expire(ctx, state.current, time.Duration(limit.Window*2)*time.Second)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+type windowLimiter struct {
+	store map[string]*windowCounter
+	mutex sync.Mutex
+	once  sync.Once
+}
+
+type windowCounter struct {
+	count     int64
+	expiredAt int64
+}
+
+var inMemoryWindowLimiter windowLimiter
+
+func (l *windowLimiter) clearExpiredItems() {
+	for {
+		time.Sleep(time.Minute)
+		now := time.Now().Unix()
+		l.mutex.Lock()
+		for key, counter := range l.store {
+			if counter.expiredAt < now {
+				delete(l.store, key)
+			}
+		}
+		l.mutex.Unlock()
+	}
+}
+
+func (l *windowLimiter) get(key string) int64 {
+	if counter, ok := l.store[key]; ok {
+		return counter.count
+	}
+	return 0
+}
+
+func (l *windowLimiter) init() {
+	l.once.Do(func() {
+		l.store = make(map[string]*windowCounter)
+		go l.clearExpiredItems()
+	})
+}
+
+func (l *windowLimiter) usage(state windowState) int64 {
+	l.init()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return int64(float64(l.get(state.previous))*state.weight) + l.get(state.current)
+}
+
+func (l *windowLimiter) add(limit *WindowLimit, state windowState, now time.Time) {
+	l.init()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.increase(limit, state, now)
+}
+
+func (l *windowLimiter) increase(limit *WindowLimit, state windowState, now time.Time) {
+	counter, ok := l.store[state.current]
+	if !ok {
+		counter = &windowCounter{expiredAt: now.Unix() + limit.Window*2}
+		l.store[state.current] = counter
+	}
+	counter.count += limit.Amount
+}
+
+func (l *windowLimiter) request(limits []WindowLimit, states []windowState, now time.Time) (bool, []WindowLimitResult, error) {
+	l.init()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	allowed := true
+	results := make([]WindowLimitResult, len(limits))
+	for i, limit := range limits {
+		used := int64(float64(l.get(states[i].previous))*states[i].weight) + l.get(states[i].current)
+		if used+limit.Amount > limit.Limit {
+			allowed = false
+		}
+		results[i] = WindowLimitResult{Used: used, Reset: states[i].reset}
+	}
+	if !allowed {
+		return false, results, nil
+	}
+	for i := range limits {
+		l.increase(&limits[i], states[i], now)
+		results[i].Used += limits[i].Amount
+	}
+	return true, results, nil
+}
@@ -0,0 +1,85 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetWindowState(t *testing.T) {
+	Convey("a quarter into the window", t, func() {
+		limit := &WindowLimit{Key: "k", Window: 60}
+		state := getWindowState(limit, time.UnixMilli(100*60000+15000))
+		So(state.weight, ShouldEqual, 0.75)
+		So(state.reset, ShouldEqual, 45*time.Second)
+		So(state.current, ShouldEqual, "windowLimit:k:100")
+		So(state.previous, ShouldEqual, "windowLimit:k:99")
+	})
+}
+
+func TestInMemoryWindowLimit(t *testing.T) {
+	Convey("the previous window is weighted by its overlap with the sliding one", t, func() {
+		var limiter windowLimiter
+		window := func(seconds int64) time.Time {
+			return time.Unix(100*60+seconds, 0)
+		}
+		tests := []struct {
+			t       time.Time
+			amount  int64
+			allowed bool
+			used    int64
+		}{
+			{window(30), 10, true, 10},
+			{window(40), 1, false, 10},
+			// 10 * 0.75 of the previous window is still in the sliding one
+			{window(75), 3, true, 10},
+			{window(75), 1, false, 10},
+			// 10 * 0.25 + 3
+			{window(105), 5, true, 10},
+			// two windows later nothing is left
+			{window(180), 10, true, 10},
+		}
+		for _, tt := range tests {
+			limits := []WindowLimit{{Key: "sliding", Limit: 10, Amount: tt.amount, Window: 60}}
+			states := []windowState{getWindowState(&limits[0], tt.t)}
+			allowed, results, err := limiter.request(limits, states, tt.t)
+			So(err, ShouldBeNil)
+			So(allowed, ShouldEqual, tt.allowed)
+			So(results[0].Used, ShouldEqual, tt.used)
+		}
+	})
+	Convey("limits are only consumed if all of them allow the request", t, func() {
+		var limiter windowLimiter
+		now := time.Unix(100*60, 0)
+		limits := []WindowLimit{
+			{Key: "requests", Limit: 5, Amount: 1, Window: 60},
+			{Key: "tokens", Limit: 100, Amount: 80, Window: 60},
+		}
+		states := []windowState{getWindowState(&limits[0], now), getWindowState(&limits[1], now)}
+		allowed, _, _ := limiter.request(limits, states, now)
+		So(allowed, ShouldBeTrue)
+		allowed, results, _ := limiter.request(limits, states, now)
+		So(allowed, ShouldBeFalse)
+		So(results[0].Used, ShouldEqual, 1)
+		So(results[1].Used, ShouldEqual, 80)
+		So(limiter.usage(states[0]), ShouldEqual, 1)
+		So(limiter.usage(states[1]), ShouldEqual, 80)
+	})
+	Convey("usage added after the request counts against the limit", t, func() {
+		defer func(enabled bool) { RedisEnabled = enabled }(RedisEnabled)
+		RedisEnabled = false
+		ctx := context.Background()
+		limit := WindowLimit{Key: fmt.Sprintf("added:%d", time.Now().UnixNano()), Limit: 10, Amount: 7, Window: 3600}
+		So(WindowLimitAdd(ctx, limit), ShouldBeNil)
+		used, err := WindowLimitUsage(ctx, limit)
+		So(err, ShouldBeNil)
+		So(used, ShouldEqual, 7)
+		limit.Amount = 4
+		allowed, _, err := WindowLimitRequest(ctx, []WindowLimit{limit})
+		So(err, ShouldBeNil)
+		So(allowed, ShouldBeFalse)
+	})
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/model"
@@ -43,10 +44,7 @@ func GetSubscription(c *gin.Context) {
 		return
 	}
 	quota := remainQuota + usedQuota
-	amount := float64(quota)
-	if config.DisplayInCurrencyEnabled {
-		amount /= config.QuotaPerUnit
-	}
+	amount := common.QuotaToCurrency(quota, getUserCurrency(c.GetInt(ctxkey.Id)))
 	if token != nil && token.UnlimitedQuota {
 		amount = 100000000
 	}
@@ -84,10 +82,7 @@ func GetUsage(c *gin.Context) {
 		})
 		return
 	}
-	amount := float64(quota)
-	if config.DisplayInCurrencyEnabled {
-		amount /= config.QuotaPerUnit
-	}
+	amount := common.QuotaToCurrency(quota, getUserCurrency(c.GetInt(ctxkey.Id)))
 	usage := OpenAIUsageResponse{
 		Object:     "list",
 		TotalUsage: amount * 100,
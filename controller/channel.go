@@ -74,6 +74,34 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+// GetChannelKey returns the key of a channel, which the other channel APIs never return.
+func GetChannelKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"key": channel.Key,
+		},
+	})
+	return
+}
+
 func AddChannel(c *gin.Context) {
 	channel := model.Channel{}
 	err := c.ShouldBindJSON(&channel)
@@ -84,6 +112,16 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	if channel.UpstreamPrices != nil {
+		err = model.ValidateUpstreamPrices(*channel.UpstreamPrices)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	channel.CreatedTime = helper.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
 	channels := make([]model.Channel, 0, len(keys))
@@ -155,6 +193,16 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if channel.UpstreamPrices != nil {
+		err = model.ValidateUpstreamPrices(*channel.UpstreamPrices)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
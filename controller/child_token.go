@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+type mintChildTokenRequest struct {
+	Name   string `json:"name"`
+	TTL    int64  `json:"ttl"` // seconds
+	Quota  int64  `json:"quota"`
+	Models string `json:"models"`
+	Scopes string `json:"scopes"`
+}
+
+func childTokenError(c *gin.Context, statusCode int, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": relaymodel.Error{
+			Message: helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
+			Type:    "one_api_error",
+		},
+	})
+}
+
+// getSubList checks that every item of list is in parentList, an empty list
+// inherits parentList and an empty parentList allows everything.
+func getSubList(list string, parentList string) (string, string) {
+	if list == "" {
+		return parentList, ""
+	}
+	if parentList == "" {
+		return list, ""
+	}
+	allowed := make(map[string]bool)
+	for _, item := range strings.Split(parentList, ",") {
+		allowed[item] = true
+	}
+	for _, item := range strings.Split(list, ",") {
+		if !allowed[item] {
+			return "", item
+		}
+	}
+	return list, ""
+}
+
+// getParentToken returns the token of the request, which must not be a child token itself.
+func getParentToken(c *gin.Context) *model.Token {
+	parent, err := model.GetTokenById(c.GetInt(ctxkey.TokenId))
+	if err != nil {
+		childTokenError(c, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	if parent.ParentId != 0 {
+		childTokenError(c, http.StatusForbidden, "子令牌不能管理子令牌")
+		return nil
+	}
+	return parent
+}
+
+// MintChildToken creates a child of the token used to call it, see model.MintChildToken.
+func MintChildToken(c *gin.Context) {
+	parent := getParentToken(c)
+	if parent == nil {
+		return
+	}
+	var req mintChildTokenRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		childTokenError(c, http.StatusBadRequest, "无效的参数")
+		return
+	}
+	if req.Name == "" {
+		req.Name = parent.Name
+	}
+	if len(req.Name) > 30 {
+		childTokenError(c, http.StatusBadRequest, "令牌名称过长")
+		return
+	}
+	if req.TTL <= 0 {
+		childTokenError(c, http.StatusBadRequest, "ttl 必须为正数")
+		return
+	}
+	if req.Quota <= 0 {
+		childTokenError(c, http.StatusBadRequest, "quota 必须为正数")
+		return
+	}
+	models, item := getSubList(req.Models, parent.GetModels())
+	if item != "" {
+		childTokenError(c, http.StatusForbidden, fmt.Sprintf("父令牌无权使用模型：%s", item))
+		return
+	}
+	parentScopes := ""
+	if parent.Scopes != nil {
+		parentScopes = *parent.Scopes
+	}
+	scopes, item := getSubList(req.Scopes, parentScopes)
+	if item == "" && req.Scopes != "" {
+		for _, scope := range strings.Split(scopes, ",") {
+			if !model.IsValidTokenScope(scope) {
+				item = scope
+				break
+			}
+		}
+	}
+	if item != "" {
+		childTokenError(c, http.StatusForbidden, fmt.Sprintf("无效的令牌权限：%s", item))
+		return
+	}
+	now := helper.GetTimestamp()
+	expiredTime := now + req.TTL
+	if parent.ExpiredTime != -1 && parent.ExpiredTime < expiredTime {
+		expiredTime = parent.ExpiredTime
+	}
+	child := &model.Token{
+		Name:         req.Name,
+		CreatorId:    parent.CreatorId,
+		CreatedTime:  now,
+		AccessedTime: now,
+		ExpiredTime:  expiredTime,
+		RemainQuota:  req.Quota,
+		Models:       &models,
+		Subnet:       parent.Subnet,
+		Scopes:       &scopes,
+		CostHeaders:  parent.CostHeaders,
+		// behaviour baked into the parent is kept, its limits and budget
+		// are shared instead, see model.ValidateUserToken
+		SystemPrompt:     parent.SystemPrompt,
+		SystemPromptMode: parent.SystemPromptMode,
+		ModelMapping:     parent.ModelMapping,
+		Tags:             parent.Tags,
+		AllowRequestTags: parent.AllowRequestTags,
+	}
+	child.SetKey(random.GenerateKey())
+	err = model.MintChildToken(c.Request.Context(), parent, child)
+	if err != nil {
+		childTokenError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, child)
+}
+
+func GetChildTokens(c *gin.Context) {
+	parent := getParentToken(c)
+	if parent == nil {
+		return
+	}
+	tokens, err := model.GetChildTokens(parent.Id)
+	if err != nil {
+		childTokenError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   tokens,
+	})
+}
+
+// RevokeChildToken disables a child token and returns its remaining quota to the parent.
+func RevokeChildToken(c *gin.Context) {
+	parent := getParentToken(c)
+	if parent == nil {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		childTokenError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	child, err := model.GetChildToken(id, parent.Id)
+	if err != nil {
+		childTokenError(c, http.StatusNotFound, "子令牌不存在")
+		return
+	}
+	err = model.RevokeChildToken(c.Request.Context(), parent, child)
+	if err != nil {
+		childTokenError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      child.Id,
+		"revoked": true,
+	})
+}
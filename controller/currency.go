@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// getUserCurrency returns the display currency of the user, falling back to
+// the default one if the user has none or it can't be fetched.
+func getUserCurrency(userId int) string {
+	code, err := model.GetUserDisplayCurrency(userId)
+	if err != nil {
+		logger.SysError("failed to fetch user display currency: " + err.Error())
+	}
+	code, _ = common.GetCurrency(code)
+	return code
+}
+
+// currencyInfo describes the amounts returned next to quota, they equal the
+// quota when DisplayInCurrencyEnabled is off.
+func currencyInfo(code string) gin.H {
+	code, currency := common.GetCurrency(code)
+	return gin.H{
+		"enabled": config.DisplayInCurrencyEnabled,
+		"code":    code,
+		"symbol":  currency.Symbol,
+		"rate":    currency.Rate,
+	}
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetAllLedger(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	accountType, _ := strconv.Atoi(c.Query("account_type"))
+	accountId, _ := strconv.Atoi(c.Query("account_id"))
+	reason := c.Query("reason")
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	entries, err := model.GetAllLedger(userId, accountType, accountId, reason, startTimestamp, endTimestamp, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    entries,
+	})
+	return
+}
+
+func GetUserLedger(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId := c.GetInt(ctxkey.Id)
+	accountType, _ := strconv.Atoi(c.Query("account_type"))
+	accountId, _ := strconv.Atoi(c.Query("account_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	entries, err := model.GetUserLedger(userId, accountType, accountId, startTimestamp, endTimestamp, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    entries,
+	})
+	return
+}
+
+func ReconcileLedger(c *gin.Context) {
+	accountType, _ := strconv.Atoi(c.Query("account_type"))
+	accountId, _ := strconv.Atoi(c.Query("account_id"))
+	if accountType != model.LedgerAccountUser && accountType != model.LedgerAccountToken || accountId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "account_type 或 account_id 无效",
+		})
+		return
+	}
+	result, err := model.ReconcileLedger(accountType, accountId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    result,
+	})
+	return
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/model"
@@ -21,7 +22,9 @@ func GetAllLogs(c *gin.Context) {
 	tokenName := c.Query("token_name")
 	modelName := c.Query("model_name")
 	channel, _ := strconv.Atoi(c.Query("channel"))
-	logs, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, p*config.ItemsPerPage, config.ItemsPerPage, channel)
+	tag := c.Query("tag")
+	endUser := c.Query("end_user")
+	logs, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, p*config.ItemsPerPage, config.ItemsPerPage, channel, tag, endUser)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -48,7 +51,9 @@ func GetUserLogs(c *gin.Context) {
 	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
 	tokenName := c.Query("token_name")
 	modelName := c.Query("model_name")
-	logs, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, p*config.ItemsPerPage, config.ItemsPerPage)
+	tag := c.Query("tag")
+	endUser := c.Query("end_user")
+	logs, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, p*config.ItemsPerPage, config.ItemsPerPage, tag, endUser)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -109,15 +114,43 @@ func GetLogsStat(c *gin.Context) {
 	username := c.Query("username")
 	modelName := c.Query("model_name")
 	channel, _ := strconv.Atoi(c.Query("channel"))
-	quotaNum := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel)
+	tag := c.Query("tag")
+	endUser := c.Query("end_user")
+	quotaNum := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, tag, endUser)
 	//tokenNum := model.SumUsedToken(logType, startTimestamp, endTimestamp, modelName, username, "")
+	currency := getUserCurrency(c.GetInt(ctxkey.Id))
+	data := gin.H{
+		"quota":    quotaNum,
+		"amount":   common.QuotaToCurrency(quotaNum, currency),
+		"currency": currencyInfo(currency),
+		//"token": tokenNum,
+	}
+	if tagKey := c.Query("group_by_tag"); tagKey != "" {
+		usages, err := model.SumUsedQuotaByTag(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tag, endUser, tagKey)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		addTagUsages(data, usages, quotaNum)
+	}
+	if c.Query("group_by_end_user") != "" {
+		usages, err := model.SumUsedQuotaByEndUser(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tag, config.MaxRecentItems)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		data["end_users"] = usages
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data": gin.H{
-			"quota": quotaNum,
-			//"token": tokenNum,
-		},
+		"data":    data,
 	})
 	return
 }
@@ -130,19 +163,58 @@ func GetLogsSelfStat(c *gin.Context) {
 	tokenName := c.Query("token_name")
 	modelName := c.Query("model_name")
 	channel, _ := strconv.Atoi(c.Query("channel"))
-	quotaNum := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel)
+	tag := c.Query("tag")
+	endUser := c.Query("end_user")
+	quotaNum := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, channel, tag, endUser)
 	//tokenNum := model.SumUsedToken(logType, startTimestamp, endTimestamp, modelName, username, tokenName)
+	currency := getUserCurrency(c.GetInt(ctxkey.Id))
+	data := gin.H{
+		"quota":    quotaNum,
+		"amount":   common.QuotaToCurrency(quotaNum, currency),
+		"currency": currencyInfo(currency),
+		//"token": tokenNum,
+	}
+	if tagKey := c.Query("group_by_tag"); tagKey != "" {
+		usages, err := model.SumUsedQuotaByTag(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tag, endUser, tagKey)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		addTagUsages(data, usages, quotaNum)
+	}
+	if c.Query("group_by_end_user") != "" {
+		usages, err := model.SumUsedQuotaByEndUser(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tag, config.MaxRecentItems)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		data["end_users"] = usages
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data": gin.H{
-			"quota": quotaNum,
-			//"token": tokenNum,
-		},
+		"data":    data,
 	})
 	return
 }
 
+// addTagUsages adds the usage by tag value to the stat, with the quota of the
+// logs without the tag as untagged_quota.
+func addTagUsages(data gin.H, usages []*model.TagUsage, quota int64) {
+	untaggedQuota := quota
+	for _, usage := range usages {
+		untaggedQuota -= usage.Quota
+	}
+	data["tags"] = usages
+	data["untagged_quota"] = untaggedQuota
+}
+
 func DeleteHistoryLogs(c *gin.Context) {
 	targetTimestamp, _ := strconv.ParseInt(c.Query("target_timestamp"), 10, 64)
 	if targetTimestamp == 0 {
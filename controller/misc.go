@@ -35,9 +35,14 @@ func GetStatus(c *gin.Context) {
 			"turnstile_check":             config.TurnstileCheckEnabled,
 			"turnstile_site_key":          config.TurnstileSiteKey,
 			"top_up_link":                 config.TopUpLink,
+			"payment_provider":            config.PaymentProvider,
+			"payment_currency":            config.PaymentCurrency,
+			"payment_min_top_up":          config.PaymentMinTopUp,
 			"chat_link":                   config.ChatLink,
 			"quota_per_unit":              config.QuotaPerUnit,
 			"display_in_currency":         config.DisplayInCurrencyEnabled,
+			"display_currency":            config.DisplayCurrency,
+			"currencies":                  common.GetCurrencies(),
 			"oidc":                        config.OidcEnabled,
 			"oidc_client_id":              config.OidcClientId,
 			"oidc_well_known":             config.OidcWellKnown,
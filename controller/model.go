@@ -3,16 +3,19 @@ package controller
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/model"
 	relay "github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/apitype"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // https://platform.openai.com/docs/api-reference/models/list
@@ -114,11 +117,62 @@ func init() {
 	}
 }
 
+// ModelPrice is what a group pays for a model right now, prices are in USD per 1M tokens.
+// Models with a price schedule also report the next time their price changes.
+type ModelPrice struct {
+	ModelRatio      float64         `json:"model_ratio"`
+	CompletionRatio float64         `json:"completion_ratio"`
+	GroupRatio      float64         `json:"group_ratio"`
+	PriceMultiplier float64         `json:"price_multiplier"`
+	InputPrice      float64         `json:"input_price"`
+	OutputPrice     float64         `json:"output_price"`
+	NextPrice       *NextModelPrice `json:"next_price,omitempty"`
+}
+
+type NextModelPrice struct {
+	Time            int64   `json:"time"`
+	PriceMultiplier float64 `json:"price_multiplier"`
+	InputPrice      float64 `json:"input_price"`
+	OutputPrice     float64 `json:"output_price"`
+}
+
+func getModelPrice(group string, modelName string, channelType int) *ModelPrice {
+	price := &ModelPrice{
+		ModelRatio:      billingratio.GetModelRatio(modelName, channelType),
+		CompletionRatio: billingratio.GetCompletionRatio(modelName, channelType),
+		GroupRatio:      billingratio.GetGroupModelRatio(group, modelName),
+	}
+	now := time.Now()
+	basePrice := price.ModelRatio * price.GroupRatio * 1000000 / config.QuotaPerUnit
+	price.PriceMultiplier = billingratio.GetPriceMultiplier(modelName, now)
+	price.InputPrice = basePrice * price.PriceMultiplier
+	price.OutputPrice = price.InputPrice * price.CompletionRatio
+	if next, multiplier, ok := billingratio.GetNextPriceChange(modelName, now); ok {
+		price.NextPrice = &NextModelPrice{
+			Time:            next.Unix(),
+			PriceMultiplier: multiplier,
+			InputPrice:      basePrice * multiplier,
+		}
+		price.NextPrice.OutputPrice = price.NextPrice.InputPrice * price.CompletionRatio
+	}
+	return price
+}
+
+// DashboardListModels also returns the prices the calling user pays, keyed like the models.
 func DashboardListModels(c *gin.Context) {
+	userGroup, _ := model.CacheGetUserGroup(c.GetInt(ctxkey.Id))
+	prices := make(map[int]map[string]*ModelPrice, len(channelId2Models))
+	for channelType, modelNames := range channelId2Models {
+		prices[channelType] = make(map[string]*ModelPrice, len(modelNames))
+		for _, modelName := range modelNames {
+			prices[channelType][modelName] = getModelPrice(userGroup, modelName, channelType)
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 		"data":    channelId2Models,
+		"prices":  prices,
 	})
 }
 
@@ -204,10 +258,15 @@ func GetUserAvailableModels(c *gin.Context) {
 		})
 		return
 	}
+	prices := make(map[string]*ModelPrice, len(models))
+	for _, modelName := range models {
+		prices[modelName] = getModelPrice(userGroup, modelName, 0)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
 		"data":    models,
+		"prices":  prices,
 	})
 	return
 }
@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type generateMonthlyStatementsRequest struct {
+	Month     string `json:"month"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+func GenerateMonthlyStatements(c *gin.Context) {
+	req := generateMonthlyStatementsRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	count, err := model.GenerateMonthlyStatements(c.Request.Context(), req.Month, req.Overwrite)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    count,
+	})
+}
+
+func statementItemType(logType int) string {
+	if logType == model.LogTypeTopup {
+		return "topup"
+	}
+	return "consume"
+}
+
+// writeMonthlyStatementsCSV writes one row per statement item, amounts are in the given currency.
+func writeMonthlyStatementsCSV(c *gin.Context, filename string, statements []*model.MonthlyStatement, currency string) {
+	ids := make([]int, 0, len(statements))
+	for _, statement := range statements {
+		ids = append(ids, statement.Id)
+	}
+	items, err := model.GetMonthlyStatementItems(ids)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	currency, _ = common.GetCurrency(currency)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"month", "user_id", "username", "group", "type", "model_name", "token_name",
+		"request_count", "prompt_tokens", "completion_tokens", "quota", "amount", "currency"})
+	for _, statement := range statements {
+		for _, item := range items[statement.Id] {
+			_ = writer.Write([]string{
+				statement.Month,
+				strconv.Itoa(statement.UserId),
+				statement.Username,
+				statement.Group,
+				statementItemType(item.Type),
+				item.ModelName,
+				item.TokenName,
+				strconv.Itoa(item.RequestCount),
+				strconv.FormatInt(item.PromptTokens, 10),
+				strconv.FormatInt(item.CompletionTokens, 10),
+				strconv.FormatInt(item.Quota, 10),
+				strconv.FormatFloat(common.QuotaToCurrency(item.Quota, currency), 'f', 6, 64),
+				currency,
+			})
+		}
+	}
+	writer.Flush()
+}
+
+func respondMonthlyStatement(c *gin.Context, statement *model.MonthlyStatement, currency string) {
+	if c.Query("format") == "csv" {
+		writeMonthlyStatementsCSV(c, fmt.Sprintf("statement-%s-%d", statement.Month, statement.UserId), []*model.MonthlyStatement{statement}, currency)
+		return
+	}
+	items, err := model.GetMonthlyStatementItems([]int{statement.Id})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"statement": statement,
+			"items":     items[statement.Id],
+			"currency":  currencyInfo(currency),
+			"amount": gin.H{
+				"consume_quota": common.QuotaToCurrency(statement.ConsumeQuota, currency),
+				"topup_quota":   common.QuotaToCurrency(statement.TopupQuota, currency),
+			},
+		},
+	})
+}
+
+// GetAllMonthlyStatements lists statements page by page, or exports all
+// statements matching the filters with format=csv.
+func GetAllMonthlyStatements(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	month := c.Query("month")
+	csvFormat := c.Query("format") == "csv"
+	startIdx, num := p*config.ItemsPerPage, config.ItemsPerPage
+	if csvFormat {
+		startIdx, num = 0, 0
+	}
+	statements, err := model.GetMonthlyStatements(userId, month, startIdx, num)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if csvFormat {
+		writeMonthlyStatementsCSV(c, fmt.Sprintf("statements-%s", month), statements, config.DisplayCurrency)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statements,
+	})
+}
+
+func GetMonthlyStatement(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	statement, err := model.GetMonthlyStatementById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	respondMonthlyStatement(c, statement, config.DisplayCurrency)
+}
+
+func GetGroupMonthlyStatements(c *gin.Context) {
+	month := c.Query("month")
+	statements, err := model.GetGroupMonthlyStatements(month)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data":    statements,
+		})
+		return
+	}
+	currency, _ := common.GetCurrency(config.DisplayCurrency)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=group-statements-%s.csv", month))
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"month", "group", "users", "request_count", "prompt_tokens", "completion_tokens",
+		"consume_quota", "consume_amount", "topup_quota", "topup_amount", "currency"})
+	for _, statement := range statements {
+		_ = writer.Write([]string{
+			month,
+			statement.Group,
+			strconv.Itoa(statement.Users),
+			strconv.Itoa(statement.RequestCount),
+			strconv.FormatInt(statement.PromptTokens, 10),
+			strconv.FormatInt(statement.CompletionTokens, 10),
+			strconv.FormatInt(statement.ConsumeQuota, 10),
+			strconv.FormatFloat(common.QuotaToCurrency(statement.ConsumeQuota, currency), 'f', 6, 64),
+			strconv.FormatInt(statement.TopupQuota, 10),
+			strconv.FormatFloat(common.QuotaToCurrency(statement.TopupQuota, currency), 'f', 6, 64),
+			currency,
+		})
+	}
+	writer.Flush()
+}
+
+func GetUserMonthlyStatements(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	statements, err := model.GetMonthlyStatements(c.GetInt(ctxkey.Id), "", p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statements,
+	})
+}
+
+func GetUserMonthlyStatement(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+	id, _ := strconv.Atoi(c.Param("id"))
+	statement, err := model.GetMonthlyStatementById(id)
+	if err == nil && statement.UserId != userId {
+		err = errors.New("账单不存在")
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	respondMonthlyStatement(c, statement, getUserCurrency(userId))
+}
+
+// AutomaticallyGenerateMonthlyStatements generates the statements of the
+// previous month once it has ended, frequency is in minutes.
+func AutomaticallyGenerateMonthlyStatements(frequency int) {
+	ctx := context.Background()
+	for {
+		time.Sleep(time.Duration(frequency) * time.Minute)
+		now := time.Now()
+		month := now.AddDate(0, 0, -now.Day()).Format(model.StatementMonthLayout)
+		count, err := model.CountMonthlyStatements(month)
+		if err != nil {
+			logger.SysError("failed to count monthly statements: " + err.Error())
+			continue
+		}
+		if count > 0 {
+			continue
+		}
+		generated, err := model.GenerateMonthlyStatements(ctx, month, false)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to generate monthly statements of %s: %s", month, err.Error()))
+			continue
+		}
+		logger.SysLog(fmt.Sprintf("generated %d monthly statements of %s", generated, month))
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/i18n"
+	"github.com/songquanpeng/one-api/common/payment"
 	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 
 	"github.com/gin-gonic/gin"
 )
@@ -85,6 +88,56 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "GroupModelRatio":
+		if err := billingratio.ValidateGroupModelRatioJSONString(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "Currencies":
+		if err := common.ValidateCurrenciesJSONString(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "DisplayCurrency":
+		if !common.IsValidCurrency(option.Value) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "货币不存在，请先在货币表中添加",
+			})
+			return
+		}
+	case "ModelPriceSchedule":
+		if err := billingratio.ValidateModelPriceScheduleJSONString(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "GroupRateLimits":
+		if err := model.ValidateGroupRateLimitsJSONString(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "PaymentProvider":
+		if option.Value != "" {
+			if _, err := payment.GetProvider(option.Value); err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "无效的支付方式",
+				})
+				return
+			}
+		}
 	}
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
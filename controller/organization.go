@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// getOperatorId returns the user making the request, under the APIs of an
+// organization ctxkey.Id is the account of the organization instead.
+func getOperatorId(c *gin.Context) int {
+	if memberId := c.GetInt(ctxkey.OrganizationMemberId); memberId != 0 {
+		return memberId
+	}
+	return c.GetInt(ctxkey.Id)
+}
+
+var errNotTokenCreator = errors.New("无权进行此操作，只能管理自己创建的令牌")
+
+// canManageToken reports whether the user may change the token, members of an
+// organization only change the tokens they created, its admins all of them.
+func canManageToken(c *gin.Context, token *model.Token) bool {
+	role := c.GetString(ctxkey.OrganizationRole)
+	if role == "" || model.OrganizationRoleAtLeast(role, model.OrganizationRoleAdmin) {
+		return true
+	}
+	return token.CreatorId == getOperatorId(c)
+}
+
+type createOrganizationRequest struct {
+	Name    string `json:"name"`
+	OwnerId int    `json:"owner_id"`
+}
+
+func CreateOrganization(c *gin.Context) {
+	req := createOrganizationRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	organization, err := model.CreateOrganization(req.Name, req.OwnerId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organization,
+	})
+	return
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	organizations, err := model.GetAllOrganizations(p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organizations,
+	})
+	return
+}
+
+func GetUserOrganizations(c *gin.Context) {
+	organizations, err := model.GetUserOrganizations(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organizations,
+	})
+	return
+}
+
+func GetOrganization(c *gin.Context) {
+	organization, err := model.GetOrganizationById(c.GetInt(ctxkey.OrganizationId))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	organization.Role = c.GetString(ctxkey.OrganizationRole)
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  "",
+		"data":     organization,
+		"currency": currencyInfo(getUserCurrency(getOperatorId(c))),
+	})
+	return
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	members, err := model.GetOrganizationMembers(c.GetInt(ctxkey.OrganizationId))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+	return
+}
+
+type organizationMemberRequest struct {
+	UserId int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	req := organizationMemberRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrganizationRoleMember
+	}
+	member, err := model.AddOrganizationMember(c.GetInt(ctxkey.OrganizationId), c.GetString(ctxkey.OrganizationRole), req.UserId, req.Role)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+	return
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	req := organizationMemberRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	err = model.UpdateOrganizationMember(c.GetInt(ctxkey.OrganizationId), c.GetString(ctxkey.OrganizationRole), req.UserId, req.Role)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// DeleteOrganizationMember removes a member, admins remove anyone and every member may leave.
+func DeleteOrganizationMember(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	role := c.GetString(ctxkey.OrganizationRole)
+	if userId != getOperatorId(c) && !model.OrganizationRoleAtLeast(role, model.OrganizationRoleAdmin) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作，需要组织角色 admin",
+		})
+		return
+	}
+	err := model.DeleteOrganizationMember(c.GetInt(ctxkey.OrganizationId), role, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+type organizationTransferRequest struct {
+	Quota int64 `json:"quota"`
+}
+
+// TransferQuotaToOrganization adds quota from the personal account of the member to the pool of the organization.
+func TransferQuotaToOrganization(c *gin.Context) {
+	req := organizationTransferRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	organization, err := model.GetOrganizationById(c.GetInt(ctxkey.OrganizationId))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.TransferQuotaToOrganization(c.Request.Context(), getOperatorId(c), organization, req.Quota)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// TransferQuotaFromOrganization withdraws quota from the pool of the organization to the personal account of the admin.
+func TransferQuotaFromOrganization(c *gin.Context) {
+	req := organizationTransferRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	organization, err := model.GetOrganizationById(c.GetInt(ctxkey.OrganizationId))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.TransferQuotaFromOrganization(c.Request.Context(), getOperatorId(c), organization, req.Quota)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
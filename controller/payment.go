@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/payment"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type paymentRequest struct {
+	Amount float64 `json:"amount"` // in PaymentCurrency
+}
+
+func RequestPayment(c *gin.Context) {
+	ctx := c.Request.Context()
+	req := paymentRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	provider, err := payment.GetProvider(config.PaymentProvider)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启在线支付",
+		})
+		return
+	}
+	if req.Amount < config.PaymentMinTopUp || req.Amount <= 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("充值金额不能低于 %.2f", config.PaymentMinTopUp),
+		})
+		return
+	}
+	rate, ok := common.GetCurrencyRate(config.PaymentCurrency)
+	if !ok {
+		logger.Error(ctx, fmt.Sprintf("payment currency %s is not in the currency table", config.PaymentCurrency))
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("管理员未配置支付货币 %s 的汇率", config.PaymentCurrency),
+		})
+		return
+	}
+	order := &model.Order{
+		TradeNo:  random.GetUUID(),
+		UserId:   c.GetInt(ctxkey.Id),
+		Provider: provider.Name(),
+		Amount:   payment.ToMinorUnits(req.Amount, config.PaymentCurrency),
+		Currency: config.PaymentCurrency,
+		// the rate is the amount of the currency per USD, QuotaPerUnit the quota per USD
+		Quota: int64(req.Amount / rate * config.QuotaPerUnit),
+	}
+	err = order.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	checkout, err := provider.CreateCheckout(ctx, &payment.CheckoutRequest{
+		TradeNo:   order.TradeNo,
+		Amount:    order.Amount,
+		Currency:  order.Currency,
+		Title:     fmt.Sprintf("%s top-up", config.SystemName),
+		NotifyURL: fmt.Sprintf("%s/api/payment/webhook/%s", config.ServerAddress, provider.Name()),
+		ReturnURL: fmt.Sprintf("%s/topup", config.ServerAddress),
+	})
+	if err != nil {
+		logger.Error(ctx, fmt.Sprintf("failed to create checkout for order %s: %s", order.TradeNo, err.Error()))
+		_ = model.FailOrder(provider.Name(), order.TradeNo, "failed to create checkout: "+err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "创建支付订单失败，请稍后重试",
+		})
+		return
+	}
+	err = order.UpdateProviderOrderId(checkout.ProviderOrderId)
+	if err != nil {
+		logger.Error(ctx, fmt.Sprintf("failed to save provider order id of order %s: %s", order.TradeNo, err.Error()))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"trade_no":     order.TradeNo,
+			"checkout_url": checkout.URL,
+		},
+	})
+	return
+}
+
+// PaymentWebhook answers with a non-2xx status when the event could not be
+// processed, so that the provider delivers it again later.
+func PaymentWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	provider, err := payment.GetProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	event, err := provider.ParseWebhook(c.Request.Header, body)
+	if err != nil {
+		logger.Warnf(ctx, "invalid %s webhook: %s", provider.Name(), err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if event != nil {
+		switch event.Type {
+		case payment.EventPaid:
+			err = model.CompleteOrder(ctx, provider.Name(), event.TradeNo, event.ProviderOrderId, event.Amount, event.Currency)
+		case payment.EventFailed:
+			err = model.FailOrder(provider.Name(), event.TradeNo, fmt.Sprintf("failed via %s", provider.Name()))
+		}
+		if err != nil {
+			logger.Error(ctx, fmt.Sprintf("failed to process %s webhook for order %s: %s", provider.Name(), event.TradeNo, err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func GetUserOrders(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	orders, err := model.GetUserOrders(c.GetInt(ctxkey.Id), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orders,
+	})
+	return
+}
+
+func GetAllOrders(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	status, _ := strconv.Atoi(c.Query("status"))
+	orders, err := model.GetAllOrders(userId, status, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orders,
+	})
+	return
+}
+
+func GetOrder(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	order, err := model.GetOrderById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	history, err := model.GetOrderHistory(order.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"order":   order,
+			"history": history,
+		},
+	})
+	return
+}
@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func GetAllPlans(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	plans, err := model.GetAllPlans(p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+	return
+}
+
+func GetPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	plan, err := model.GetPlanById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+	return
+}
+
+func validatePlan(plan *model.Plan) error {
+	if len(plan.Name) == 0 || len(plan.Name) > 64 {
+		return fmt.Errorf("套餐名称长度必须在1-64之间")
+	}
+	if !model.IsValidPlanPeriod(plan.Period) {
+		return fmt.Errorf("无效的发放周期：%s", plan.Period)
+	}
+	if plan.Quota < 0 || plan.Duration < 0 {
+		return fmt.Errorf("额度和有效期不能为负数")
+	}
+	return nil
+}
+
+func AddPlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := c.ShouldBindJSON(&plan)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = validatePlan(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanPlan := model.Plan{
+		Name:        plan.Name,
+		Description: plan.Description,
+		Status:      model.PlanStatusEnabled,
+		Quota:       plan.Quota,
+		Period:      plan.Period,
+		CarryOver:   plan.CarryOver,
+		Group:       plan.Group,
+		Duration:    plan.Duration,
+	}
+	err = cleanPlan.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanPlan,
+	})
+	return
+}
+
+func UpdatePlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := c.ShouldBindJSON(&plan)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = validatePlan(&plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanPlan, err := model.GetPlanById(plan.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// If you add more fields, please also update plan.Update()
+	cleanPlan.Name = plan.Name
+	cleanPlan.Description = plan.Description
+	cleanPlan.Quota = plan.Quota
+	cleanPlan.Period = plan.Period
+	cleanPlan.CarryOver = plan.CarryOver
+	cleanPlan.Group = plan.Group
+	cleanPlan.Duration = plan.Duration
+	if plan.Status != 0 {
+		cleanPlan.Status = plan.Status
+	}
+	err = cleanPlan.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanPlan,
+	})
+	return
+}
+
+func DeletePlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeletePlanById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+type planSubscriptionRequest struct {
+	UserId int `json:"user_id"`
+	PlanId int `json:"plan_id"`
+}
+
+func SubscribeUserPlan(c *gin.Context) {
+	req := planSubscriptionRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.SubscribeUserPlan(c.Request.Context(), req.UserId, req.PlanId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func CancelUserPlan(c *gin.Context) {
+	req := planSubscriptionRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.CancelUserPlan(c.Request.Context(), req.UserId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func AutomaticallyGrantPlanQuota(frequency int) {
+	ctx := context.Background()
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		granted, err := model.GrantDuePlanQuota(ctx)
+		if err != nil {
+			logger.SysError("failed to grant plan quota: " + err.Error())
+			continue
+		}
+		if granted > 0 {
+			logger.SysLog(fmt.Sprintf("plan quota granted to %d users", granted))
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetProfitReport compares revenue with the estimated upstream cost, grouped
+// by group_by, a comma separated list of day, channel, model and group.
+func GetProfitReport(c *gin.Context) {
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if endTimestamp == 0 {
+		endTimestamp = helper.GetTimestamp()
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	if startTimestamp == 0 {
+		startTimestamp = endTimestamp - 7*24*60*60
+	}
+	groupBy := c.DefaultQuery("group_by", "day,channel,model")
+	var dimensions []string
+	for _, dimension := range strings.Split(groupBy, ",") {
+		dimension = strings.TrimSpace(dimension)
+		if dimension == "" {
+			continue
+		}
+		if !model.IsValidProfitDimension(dimension) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("无效的分组维度：%s", dimension),
+			})
+			return
+		}
+		dimensions = append(dimensions, dimension)
+	}
+	items, total, err := model.GetProfitReport(startTimestamp, endTimestamp, dimensions)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"items": items,
+			"total": total,
+		},
+	})
+}
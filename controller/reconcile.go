@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// ReconcileQuota runs in dry-run mode unless dry_run=false is given explicitly.
+func ReconcileQuota(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	tolerance := int64(config.QuotaReconcileTolerance)
+	if c.Query("tolerance") != "" {
+		tolerance, _ = strconv.ParseInt(c.Query("tolerance"), 10, 64)
+	}
+	dryRun := c.Query("dry_run") != "false"
+	report, err := model.ReconcileQuota(c.Request.Context(), startTimestamp, endTimestamp, tolerance, dryRun)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    report,
+	})
+	return
+}
+
+func AutomaticallyReconcileQuota(frequency int) {
+	ctx := context.Background()
+	var lastEnd int64
+	for {
+		time.Sleep(time.Duration(frequency) * time.Minute)
+		// leave time for in-flight requests and batch updates to be billed
+		// before their period is checked
+		end := helper.GetTimestamp() - model.ReconcileRequestLifetime()
+		start := lastEnd + 1
+		if lastEnd == 0 {
+			start = end - int64(frequency*60)
+		}
+		logger.SysLog("reconciling quota")
+		report, err := model.ReconcileQuota(ctx, start, end, int64(config.QuotaReconcileTolerance), !config.QuotaReconcileAutoFixEnabled)
+		if err != nil {
+			logger.SysError("failed to reconcile quota: " + err.Error())
+			continue
+		}
+		lastEnd = end
+		for _, discrepancy := range report.Discrepancies {
+			logger.SysLog(fmt.Sprintf("quota discrepancy: account %d#%d (%s), expected %d, recorded %d, fixed: %t",
+				discrepancy.AccountType, discrepancy.AccountId, discrepancy.Name, discrepancy.ExpectedQuota, discrepancy.RecordedQuota, discrepancy.Fixed))
+		}
+		logger.SysLog(fmt.Sprintf("quota reconciliation finished, %d users and %d tokens checked, %d discrepancies found",
+			report.CheckedUsers, report.CheckedTokens, len(report.Discrepancies)))
+	}
+}
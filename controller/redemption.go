@@ -1,10 +1,14 @@
 package controller
 
 import (
+	"encoding/csv"
+	"fmt"
+
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
@@ -75,6 +79,46 @@ func GetRedemption(c *gin.Context) {
 	return
 }
 
+// maxCSVRedemptionCount bounds bulk generation, which is streamed back as CSV
+const maxCSVRedemptionCount = 10000
+
+func validateRedemption(redemption *model.Redemption) error {
+	if len(redemption.Name) == 0 || len(redemption.Name) > 20 {
+		return fmt.Errorf("兑换码名称长度必须在1-20之间")
+	}
+	if len(redemption.Campaign) > 64 {
+		return fmt.Errorf("活动名称过长")
+	}
+	if redemption.MaxUses < 0 || redemption.PerUserLimit < 0 {
+		return fmt.Errorf("使用次数不能为负数")
+	}
+	return nil
+}
+
+func newRedemption(userId int, redemption *model.Redemption) *model.Redemption {
+	expiredTime := redemption.ExpiredTime
+	if expiredTime == 0 {
+		expiredTime = -1
+	}
+	maxUses := redemption.MaxUses
+	if maxUses == 0 {
+		maxUses = 1
+	}
+	return &model.Redemption{
+		UserId:       userId,
+		Name:         redemption.Name,
+		Key:          random.GetUUID(),
+		CreatedTime:  helper.GetTimestamp(),
+		Quota:        redemption.Quota,
+		Campaign:     redemption.Campaign,
+		ExpiredTime:  expiredTime,
+		MaxUses:      maxUses,
+		PerUserLimit: redemption.PerUserLimit,
+		Group:        redemption.Group,
+		PlanId:       redemption.PlanId,
+	}
+}
+
 func AddRedemption(c *gin.Context) {
 	redemption := model.Redemption{}
 	err := c.ShouldBindJSON(&redemption)
@@ -85,10 +129,10 @@ func AddRedemption(c *gin.Context) {
 		})
 		return
 	}
-	if len(redemption.Name) == 0 || len(redemption.Name) > 20 {
+	if err = validateRedemption(&redemption); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "兑换码名称长度必须在1-20之间",
+			"message": err.Error(),
 		})
 		return
 	}
@@ -99,23 +143,20 @@ func AddRedemption(c *gin.Context) {
 		})
 		return
 	}
+	if c.Query("format") == "csv" {
+		streamRedemptionsCSV(c, &redemption)
+		return
+	}
 	if redemption.Count > 100 {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "一次兑换码批量生成的个数不能大于 100",
+			"message": "一次兑换码批量生成的个数不能大于 100，更多请使用 CSV 格式",
 		})
 		return
 	}
 	var keys []string
 	for i := 0; i < redemption.Count; i++ {
-		key := random.GetUUID()
-		cleanRedemption := model.Redemption{
-			UserId:      c.GetInt(ctxkey.Id),
-			Name:        redemption.Name,
-			Key:         key,
-			CreatedTime: helper.GetTimestamp(),
-			Quota:       redemption.Quota,
-		}
+		cleanRedemption := newRedemption(c.GetInt(ctxkey.Id), &redemption)
 		err = cleanRedemption.Insert()
 		if err != nil {
 			c.JSON(http.StatusOK, gin.H{
@@ -125,7 +166,7 @@ func AddRedemption(c *gin.Context) {
 			})
 			return
 		}
-		keys = append(keys, key)
+		keys = append(keys, cleanRedemption.Key)
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -135,6 +176,80 @@ func AddRedemption(c *gin.Context) {
 	return
 }
 
+// streamRedemptionsCSV inserts the codes batch by batch and writes each batch
+// out once it is saved, so every key in the output is valid even if a later
+// batch fails and the output is cut short.
+func streamRedemptionsCSV(c *gin.Context, redemption *model.Redemption) {
+	if redemption.Count > maxCSVRedemptionCount {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("一次兑换码批量生成的个数不能大于 %d", maxCSVRedemptionCount),
+		})
+		return
+	}
+	const batchSize = 500
+	userId := c.GetInt(ctxkey.Id)
+	var writer *csv.Writer
+	for generated := 0; generated < redemption.Count; generated += batchSize {
+		size := redemption.Count - generated
+		if size > batchSize {
+			size = batchSize
+		}
+		batch := make([]*model.Redemption, 0, size)
+		for i := 0; i < size; i++ {
+			batch = append(batch, newRedemption(userId, redemption))
+		}
+		err := model.BatchInsertRedemptions(batch)
+		if err != nil {
+			logger.Error(c.Request.Context(), fmt.Sprintf("failed to generate redemptions after %d codes: %s", generated, err.Error()))
+			if writer == nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+			}
+			return
+		}
+		if writer == nil {
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=redemptions-%d.csv", helper.GetTimestamp()))
+			c.Status(http.StatusOK)
+			writer = csv.NewWriter(c.Writer)
+			_ = writer.Write([]string{"key", "name", "campaign", "quota", "max_uses", "per_user_limit", "expired_time"})
+		}
+		for _, r := range batch {
+			_ = writer.Write([]string{
+				r.Key,
+				r.Name,
+				r.Campaign,
+				strconv.FormatInt(r.Quota, 10),
+				strconv.Itoa(r.MaxUses),
+				strconv.Itoa(r.PerUserLimit),
+				strconv.FormatInt(r.ExpiredTime, 10),
+			})
+		}
+		writer.Flush()
+		c.Writer.Flush()
+	}
+}
+
+func GetRedemptionCampaignReports(c *gin.Context) {
+	reports, err := model.GetRedemptionCampaignReports(c.Query("campaign"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    reports,
+	})
+	return
+}
+
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	err := model.DeleteRedemptionById(id)
@@ -175,8 +290,36 @@ func UpdateRedemption(c *gin.Context) {
 		cleanRedemption.Status = redemption.Status
 	} else {
 		// If you add more fields, please also update redemption.Update()
+		if err = validateRedemption(&redemption); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 		cleanRedemption.Name = redemption.Name
 		cleanRedemption.Quota = redemption.Quota
+		cleanRedemption.Campaign = redemption.Campaign
+		cleanRedemption.ExpiredTime = redemption.ExpiredTime
+		oldMaxUses := cleanRedemption.MaxUses
+		cleanRedemption.MaxUses = redemption.MaxUses
+		cleanRedemption.PerUserLimit = redemption.PerUserLimit
+		cleanRedemption.Group = redemption.Group
+		cleanRedemption.PlanId = redemption.PlanId
+		if cleanRedemption.ExpiredTime == 0 {
+			cleanRedemption.ExpiredTime = -1
+		}
+		if cleanRedemption.MaxUses == 0 {
+			cleanRedemption.MaxUses = 1
+		}
+		// a used up code can be redeemed again once max_uses is raised above
+		// its used count, and the other way round
+		if cleanRedemption.Status == model.RedemptionCodeStatusUsed && cleanRedemption.MaxUses > oldMaxUses &&
+			cleanRedemption.UsedCount < cleanRedemption.MaxUses {
+			cleanRedemption.Status = model.RedemptionCodeStatusEnabled
+		} else if cleanRedemption.Status == model.RedemptionCodeStatusEnabled && cleanRedemption.UsedCount >= cleanRedemption.MaxUses {
+			cleanRedemption.Status = model.RedemptionCodeStatusUsed
+		}
 	}
 	err = cleanRedemption.Update()
 	if err != nil {
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// referralSettleLag leaves time for in-flight requests to be logged before
+// their consumption is settled.
+const referralSettleLag = 5 * 60
+
+func GetReferralStat(c *gin.Context) {
+	stat, err := model.GetReferralStat(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    stat,
+	})
+	return
+}
+
+func GetUserReferralCommissions(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	commissions, err := model.GetUserReferralCommissions(c.GetInt(ctxkey.Id), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    commissions,
+	})
+	return
+}
+
+type affTransferRequest struct {
+	Quota int64 `json:"quota"`
+}
+
+func TransferAffQuota(c *gin.Context) {
+	req := affTransferRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.TransferAffQuota(c.Request.Context(), c.GetInt(ctxkey.Id), req.Quota)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// SettleReferralCommission settles up to a few minutes ago, start_timestamp is
+// only used for the very first settlement and defaults to one day before.
+func SettleReferralCommission(c *gin.Context) {
+	endTimestamp := helper.GetTimestamp() - referralSettleLag
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	if startTimestamp == 0 {
+		startTimestamp = endTimestamp - 24*60*60
+	}
+	settlement, err := model.SettleReferralCommission(c.Request.Context(), startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    settlement,
+	})
+	return
+}
+
+func AutomaticallySettleReferralCommission(frequency int) {
+	ctx := context.Background()
+	for {
+		time.Sleep(time.Duration(frequency) * time.Minute)
+		if !config.ReferralCommissionEnabled {
+			continue
+		}
+		endTimestamp := helper.GetTimestamp() - referralSettleLag
+		settlement, err := model.SettleReferralCommission(ctx, endTimestamp-int64(frequency*60), endTimestamp)
+		if err != nil {
+			logger.SysError("failed to settle referral commission: " + err.Error())
+			continue
+		}
+		logger.SysLog(fmt.Sprintf("referral commission settled, %d invitees, %d quota", settlement.Invitees, settlement.Commission))
+	}
+}
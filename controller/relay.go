@@ -131,6 +131,20 @@ func processChannelRelayError(ctx context.Context, userId int, channelId int, ch
 	}
 }
 
+// Estimate returns the cost of a chat, completion, embedding or image request
+// without relaying it.
+func Estimate(c *gin.Context) {
+	estimate, bizErr := controller.EstimateHelper(c)
+	if bizErr != nil {
+		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, c.GetString(helper.RequestIdKey))
+		c.JSON(bizErr.StatusCode, gin.H{
+			"error": bizErr.Error,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, estimate)
+}
+
 func RelayNotImplemented(c *gin.Context) {
 	err := model.Error{
 		Message: "API not implemented",
@@ -1,8 +1,10 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
@@ -11,6 +13,8 @@ import (
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func GetAllTokens(c *gin.Context) {
@@ -30,14 +34,29 @@ func GetAllTokens(c *gin.Context) {
 		})
 		return
 	}
+	currency := getUserCurrency(userId)
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"data":    tokens,
+		"success":  true,
+		"message":  "",
+		"data":     tokens,
+		"currency": currencyInfo(currency),
+		"amounts":  getTokenAmounts(tokens, currency),
 	})
 	return
 }
 
+// getTokenAmounts converts the quota of the tokens, keyed by token id.
+func getTokenAmounts(tokens []*model.Token, currency string) map[int]gin.H {
+	amounts := make(map[int]gin.H, len(tokens))
+	for _, token := range tokens {
+		amounts[token.Id] = gin.H{
+			"remain_quota": common.QuotaToCurrency(token.RemainQuota, currency),
+			"used_quota":   common.QuotaToCurrency(token.UsedQuota, currency),
+		}
+	}
+	return amounts
+}
+
 func SearchTokens(c *gin.Context) {
 	userId := c.GetInt(ctxkey.Id)
 	keyword := c.Query("keyword")
@@ -49,10 +68,13 @@ func SearchTokens(c *gin.Context) {
 		})
 		return
 	}
+	currency := getUserCurrency(userId)
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"data":    tokens,
+		"success":  true,
+		"message":  "",
+		"data":     tokens,
+		"currency": currencyInfo(currency),
+		"amounts":  getTokenAmounts(tokens, currency),
 	})
 	return
 }
@@ -117,6 +139,38 @@ func validateToken(c *gin.Context, token model.Token) error {
 			return fmt.Errorf("无效的网段：%s", err.Error())
 		}
 	}
+	if token.Scopes != nil && *token.Scopes != "" {
+		for _, scope := range strings.Split(*token.Scopes, ",") {
+			if !model.IsValidTokenScope(scope) {
+				return fmt.Errorf("无效的令牌权限：%s", scope)
+			}
+		}
+	}
+	if !model.IsValidTokenBudgetPeriod(token.BudgetPeriod) {
+		return fmt.Errorf("无效的额度周期：%s", token.BudgetPeriod)
+	}
+	if token.BudgetQuota < 0 {
+		return fmt.Errorf("周期额度不能为负数")
+	}
+	if token.RPM < 0 || token.TPM < 0 || token.RPD < 0 ||
+		token.EndUserRateLimit.RPM < 0 || token.EndUserRateLimit.TPM < 0 || token.EndUserRateLimit.RPD < 0 {
+		return fmt.Errorf("速率限制不能为负数")
+	}
+	if token.EndUserQuota < 0 {
+		return fmt.Errorf("终端用户额度不能为负数")
+	}
+	if _, err := model.ParseTags(token.GetTags()); err != nil {
+		return err
+	}
+	if !model.IsValidTokenSystemPromptMode(token.SystemPromptMode) {
+		return fmt.Errorf("无效的系统提示词模式：%s", token.SystemPromptMode)
+	}
+	if token.ModelMapping != nil && *token.ModelMapping != "" {
+		modelMapping := make(map[string]string)
+		if err := json.Unmarshal([]byte(*token.ModelMapping), &modelMapping); err != nil {
+			return fmt.Errorf("模型映射必须是合法的 JSON 格式")
+		}
+	}
 	return nil
 }
 
@@ -140,17 +194,31 @@ func AddToken(c *gin.Context) {
 	}
 
 	cleanToken := model.Token{
-		UserId:         c.GetInt(ctxkey.Id),
-		Name:           token.Name,
-		Key:            random.GenerateKey(),
-		CreatedTime:    helper.GetTimestamp(),
-		AccessedTime:   helper.GetTimestamp(),
-		ExpiredTime:    token.ExpiredTime,
-		RemainQuota:    token.RemainQuota,
-		UnlimitedQuota: token.UnlimitedQuota,
-		Models:         token.Models,
-		Subnet:         token.Subnet,
+		UserId:           c.GetInt(ctxkey.Id),
+		CreatorId:        getOperatorId(c),
+		Name:             token.Name,
+		CreatedTime:      helper.GetTimestamp(),
+		AccessedTime:     helper.GetTimestamp(),
+		ExpiredTime:      token.ExpiredTime,
+		RemainQuota:      token.RemainQuota,
+		UnlimitedQuota:   token.UnlimitedQuota,
+		Models:           token.Models,
+		Subnet:           token.Subnet,
+		Scopes:           token.Scopes,
+		BudgetPeriod:     token.BudgetPeriod,
+		BudgetQuota:      token.BudgetQuota,
+		CostHeaders:      token.CostHeaders,
+		RateLimit:        token.RateLimit,
+		SystemPrompt:     token.SystemPrompt,
+		SystemPromptMode: token.SystemPromptMode,
+		ModelMapping:     token.ModelMapping,
+		Tags:             token.Tags,
+		AllowRequestTags: token.AllowRequestTags,
+		EndUserRateLimit: token.EndUserRateLimit,
+		EndUserQuota:     token.EndUserQuota,
 	}
+	cleanToken.PeriodResetTime = model.NextBudgetResetTime(cleanToken.BudgetPeriod, time.Now())
+	cleanToken.SetKey(random.GenerateKey())
 	err = cleanToken.Insert()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -159,6 +227,7 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordTokenLimit(c.Request.Context(), &cleanToken, 0, false)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -170,7 +239,77 @@ func AddToken(c *gin.Context) {
 func DeleteToken(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	userId := c.GetInt(ctxkey.Id)
-	err := model.DeleteTokenById(id, userId)
+	token, err := model.GetTokenByIds(id, userId)
+	if err == nil && !canManageToken(c, token) {
+		err = errNotTokenCreator
+	}
+	if err == nil {
+		err = model.DeleteTokenById(id, userId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+const maxTokenRotationGracePeriod = 30 * 24 * 60 * 60
+
+// RotateToken issues a new key for a token, the old key keeps working for
+// grace_period seconds, TOKEN_ROTATION_GRACE_PERIOD by default.
+func RotateToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt(ctxkey.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var req struct {
+		GracePeriod *int64 `json:"grace_period"`
+	}
+	if c.Request.ContentLength > 0 {
+		err = c.ShouldBindJSON(&req)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的参数",
+			})
+			return
+		}
+	}
+	gracePeriod := int64(config.TokenRotationGracePeriod)
+	if req.GracePeriod != nil {
+		gracePeriod = *req.GracePeriod
+	}
+	if gracePeriod < 0 || gracePeriod > maxTokenRotationGracePeriod {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("宽限期须在 0 到 %d 秒之间", maxTokenRotationGracePeriod),
+		})
+		return
+	}
+	token, err := model.GetTokenByIds(id, userId)
+	if err == nil && !canManageToken(c, token) {
+		err = errNotTokenCreator
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = token.Rotate(random.GenerateKey(), gracePeriod)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -181,6 +320,7 @@ func DeleteToken(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data":    token,
 	})
 	return
 }
@@ -206,6 +346,9 @@ func UpdateToken(c *gin.Context) {
 		return
 	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
+	if err == nil && !canManageToken(c, cleanToken) {
+		err = errNotTokenCreator
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -229,6 +372,8 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	originRemainQuota := cleanToken.RemainQuota
+	originUnlimitedQuota := cleanToken.UnlimitedQuota
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
@@ -239,8 +384,22 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.Scopes = token.Scopes
+		cleanToken.BudgetQuota = token.BudgetQuota
+		cleanToken.CostHeaders = token.CostHeaders
+		cleanToken.RateLimit = token.RateLimit
+		cleanToken.SystemPrompt = token.SystemPrompt
+		cleanToken.SystemPromptMode = token.SystemPromptMode
+		cleanToken.ModelMapping = token.ModelMapping
+		cleanToken.Tags = token.Tags
+		cleanToken.AllowRequestTags = token.AllowRequestTags
+		cleanToken.EndUserRateLimit = token.EndUserRateLimit
+		cleanToken.EndUserQuota = token.EndUserQuota
 	}
 	err = cleanToken.Update()
+	if err == nil && statusOnly == "" {
+		err = cleanToken.SetBudgetPeriod(token.BudgetPeriod)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -248,6 +407,17 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	model.RecordTokenLimit(c.Request.Context(), cleanToken, originRemainQuota, originUnlimitedQuota)
+	if cleanToken.Status == model.TokenStatusDisabled {
+		err = model.RevokeChildTokens(c.Request.Context(), cleanToken)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -357,9 +358,15 @@ func GetSelf(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"data":    user,
+		"success":  true,
+		"message":  "",
+		"data":     user,
+		"currency": currencyInfo(user.DisplayCurrency),
+		"amount": gin.H{
+			"quota":      common.QuotaToCurrency(user.Quota, user.DisplayCurrency),
+			"used_quota": common.QuotaToCurrency(user.UsedQuota, user.DisplayCurrency),
+			"aff_quota":  common.QuotaToCurrency(user.AffQuota, user.DisplayCurrency),
+		},
 	})
 	return
 }
@@ -393,6 +400,13 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if originUser.IsOrganizationAccount() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织账户只能通过组织接口管理",
+		})
+		return
+	}
 	myRole := c.GetInt(ctxkey.Role)
 	if myRole <= originUser.Role && myRole != model.RoleRootUser {
 		c.JSON(http.StatusOK, gin.H{
@@ -411,6 +425,13 @@ func UpdateUser(c *gin.Context) {
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
+	if !updatedUser.RateLimit.IsValid() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "速率限制只能为 -1、0 或正数",
+		})
+		return
+	}
 	updatePassword := updatedUser.Password != ""
 	if err := updatedUser.Update(updatePassword); err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -419,7 +440,15 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := model.UpdateUserRateLimit(updatedUser.Id, updatedUser.RateLimit); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if originUser.Quota != updatedUser.Quota {
+		model.RecordQuotaAdjustment(ctx, model.LedgerAccountUser, originUser.Id, originUser.Id, updatedUser.Quota-originUser.Quota, model.LedgerReasonAdmin, "")
 		model.RecordLog(ctx, originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -431,7 +460,17 @@ func UpdateUser(c *gin.Context) {
 
 func UpdateSelf(c *gin.Context) {
 	var user model.User
-	err := json.NewDecoder(c.Request.Body).Decode(&user)
+	// display_currency is only changed when present, "" resets it to the default
+	var currency struct {
+		DisplayCurrency *string `json:"display_currency"`
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &user)
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &currency)
+	}
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -450,18 +489,32 @@ func UpdateSelf(c *gin.Context) {
 		return
 	}
 
+	user.DisplayCurrency = common.NormalizeCurrency(user.DisplayCurrency)
+	if user.DisplayCurrency != "" && !common.IsValidCurrency(user.DisplayCurrency) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持该货币",
+		})
+		return
+	}
+
 	cleanUser := model.User{
-		Id:          c.GetInt(ctxkey.Id),
-		Username:    user.Username,
-		Password:    user.Password,
-		DisplayName: user.DisplayName,
+		Id:              c.GetInt(ctxkey.Id),
+		Username:        user.Username,
+		Password:        user.Password,
+		DisplayName:     user.DisplayName,
+		DisplayCurrency: user.DisplayCurrency,
 	}
 	if user.Password == "$I_LOVE_U" {
 		user.Password = "" // rollback to what it should be
 		cleanUser.Password = ""
 	}
 	updatePassword := user.Password != ""
-	if err := cleanUser.Update(updatePassword); err != nil {
+	err = cleanUser.Update(updatePassword)
+	if err == nil && currency.DisplayCurrency != nil {
+		err = model.SetUserDisplayCurrency(cleanUser.Id, user.DisplayCurrency)
+	}
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": err.Error(),
@@ -493,6 +546,13 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	if originUser.IsOrganizationAccount() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织账户只能通过组织接口管理",
+		})
+		return
+	}
 	myRole := c.GetInt("role")
 	if myRole <= originUser.Role {
 		c.JSON(http.StatusOK, gin.H{
@@ -617,6 +677,13 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	if user.IsOrganizationAccount() {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织账户只能通过组织接口管理",
+		})
+		return
+	}
 	myRole := c.GetInt("role")
 	if myRole <= user.Role && myRole != model.RoleRootUser {
 		c.JSON(http.StatusOK, gin.H{
@@ -796,7 +863,7 @@ func AdminTopUp(c *gin.Context) {
 		})
 		return
 	}
-	err = model.IncreaseUserQuota(req.UserId, int64(req.Quota))
+	err = model.IncreaseUserQuota(ctx, req.UserId, int64(req.Quota), model.LedgerReasonTopUp)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
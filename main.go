@@ -37,6 +37,9 @@ func main() {
 	if config.DebugEnabled {
 		logger.SysLog("running in debug mode")
 	}
+	if config.TokenKeyPepper == "" {
+		logger.SysWarn("TOKEN_KEY_PEPPER is not set, token keys are hashed without a secret; set it before tokens are created, changing it later invalidates every token")
+	}
 
 	// Initialize SQL Database
 	model.InitDB()
@@ -83,6 +86,18 @@ func main() {
 		}
 		go controller.AutomaticallyTestChannels(frequency)
 	}
+	if config.QuotaReconcileFrequency > 0 && config.IsMasterNode {
+		go controller.AutomaticallyReconcileQuota(config.QuotaReconcileFrequency)
+	}
+	if config.PlanGrantFrequency > 0 && config.IsMasterNode {
+		go controller.AutomaticallyGrantPlanQuota(config.PlanGrantFrequency)
+	}
+	if config.ReferralSettleFrequency > 0 && config.IsMasterNode {
+		go controller.AutomaticallySettleReferralCommission(config.ReferralSettleFrequency)
+	}
+	if config.MonthlyStatementFrequency > 0 && config.IsMasterNode {
+		go controller.AutomaticallyGenerateMonthlyStatements(config.MonthlyStatementFrequency)
+	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
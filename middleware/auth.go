@@ -9,10 +9,12 @@ import (
 	"github.com/songquanpeng/one-api/common/network"
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-func authHelper(c *gin.Context, minRole int) {
+// authHelper checks the user has at least minRole, and the permission unless it is empty
+func authHelper(c *gin.Context, minRole int, permission string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -64,6 +66,14 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if permission != "" && !model.HasPermission(id.(int), role.(int), permission) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("无权进行此操作，需要权限 %s", permission),
+		})
+		c.Abort()
+		return
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
@@ -72,19 +82,68 @@ func authHelper(c *gin.Context, minRole int) {
 
 func UserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, model.RoleCommonUser)
+		authHelper(c, model.RoleCommonUser, "")
 	}
 }
 
 func AdminAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, model.RoleAdminUser)
+		authHelper(c, model.RoleAdminUser, "")
 	}
 }
 
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, model.RoleRootUser)
+		authHelper(c, model.RoleRootUser, "")
+	}
+}
+
+// PermissionAuth lets in the admins with the permission, see model.GetUserPermissions
+func PermissionAuth(permission string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, model.RoleAdminUser, permission)
+	}
+}
+
+// OrganizationAuth must follow UserAuth, it checks that the user is a member of the
+// organization in the org_id param with at least minRole. The rest of the chain
+// acts on the account of the organization, so the handlers of personal accounts can be reused.
+func OrganizationAuth(minRole string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		userId := c.GetInt(ctxkey.Id)
+		organizationId, _ := strconv.Atoi(c.Param("org_id"))
+		organization, role, err := model.GetOrganizationMembership(organizationId, userId)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		if !model.OrganizationRoleAtLeast(role, minRole) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("无权进行此操作，需要组织角色 %s", minRole),
+			})
+			c.Abort()
+			return
+		}
+		account, err := model.GetUserById(organization.UserId, false)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		c.Set(ctxkey.OrganizationId, organization.Id)
+		c.Set(ctxkey.OrganizationRole, role)
+		c.Set(ctxkey.OrganizationMemberId, userId)
+		c.Set(ctxkey.Id, account.Id)
+		c.Set(ctxkey.Username, account.Username)
+		c.Next()
 	}
 }
 
@@ -107,6 +166,27 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		if scope := getRequestScope(c); scope != "" && !token.HasScope(scope) {
+			abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌无权调用此接口，需要权限：%s", scope))
+			return
+		}
+		tags, err := getRequestTags(c, token)
+		if err != nil {
+			abortWithMessage(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if tags != "" {
+			c.Request = c.Request.WithContext(model.WithLogTags(c.Request.Context(), tags))
+		}
+		endUser, err := getRequestEndUser(c)
+		if err != nil {
+			abortWithMessage(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if endUser != "" {
+			c.Set(ctxkey.EndUser, endUser)
+			c.Request = c.Request.WithContext(model.WithEndUser(c.Request.Context(), endUser))
+		}
 		userEnabled, err := model.CacheIsUserEnabled(token.UserId)
 		if err != nil {
 			abortWithMessage(c, http.StatusInternalServerError, err.Error())
@@ -121,6 +201,11 @@ func TokenAuth() func(c *gin.Context) {
 			abortWithMessage(c, http.StatusBadRequest, err.Error())
 			return
 		}
+		// channels are selected for the model the token maps the request to
+		tokenModelMapping := token.GetModelMapping()
+		if tokenModelMapping[requestModel] != "" {
+			requestModel = tokenModelMapping[requestModel]
+		}
 		c.Set(ctxkey.RequestModel, requestModel)
 		if token.Models != nil && *token.Models != "" {
 			c.Set(ctxkey.AvailableModels, *token.Models)
@@ -132,6 +217,14 @@ func TokenAuth() func(c *gin.Context) {
 		c.Set(ctxkey.Id, token.UserId)
 		c.Set(ctxkey.TokenId, token.Id)
 		c.Set(ctxkey.TokenName, token.Name)
+		c.Set(ctxkey.CostHeaders, token.CostHeaders)
+		c.Set(ctxkey.TokenRateLimit, token.RateLimit)
+		c.Set(ctxkey.TokenEndUserRateLimit, token.EndUserRateLimit)
+		c.Set(ctxkey.TokenEndUserQuota, token.EndUserQuota)
+		c.Set(ctxkey.TokenLimitId, token.LimitId())
+		c.Set(ctxkey.TokenModelMapping, tokenModelMapping)
+		c.Set(ctxkey.TokenSystemPrompt, token.GetSystemPrompt())
+		c.Set(ctxkey.TokenSystemPromptMode, token.SystemPromptMode)
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set(ctxkey.SpecificChannelId, parts[1])
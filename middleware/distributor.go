@@ -15,6 +15,7 @@ import (
 
 type ModelRequest struct {
 	Model string `json:"model" form:"model"`
+	User  string `json:"user" form:"user"` // the end user, see model.WithEndUser
 }
 
 func Distribute() func(c *gin.Context) {
@@ -4,12 +4,19 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 var timeFormat = "2006-01-02T15:04:05.000Z"
@@ -109,3 +116,162 @@ func DownloadRateLimit() func(c *gin.Context) {
 func UploadRateLimit() func(c *gin.Context) {
 	return rateLimitFactory(config.UploadRateLimitNum, config.UploadRateLimitDuration, "UP")
 }
+
+type relayRateLimit struct {
+	name   string // shown in the error message
+	key    string
+	limit  int
+	amount int64
+	window int64
+	tokens bool // counted in prompt tokens instead of requests
+}
+
+// getPromptTokens counts the prompt of a relay request for TPM, it is 0 for
+// requests without a text prompt, whose bodies are not parsed at all, e.g.
+// proxied requests that are not JSON objects.
+func getPromptTokens(c *gin.Context) (int, error) {
+	relayMode := relaymode.GetByPath(c.Request.URL.Path)
+	switch relayMode {
+	case relaymode.ChatCompletions, relaymode.Completions, relaymode.Embeddings, relaymode.Moderations:
+	default:
+		return 0, nil
+	}
+	request := &relaymodel.GeneralOpenAIRequest{}
+	err := common.UnmarshalBodyReusable(c, request)
+	if err != nil {
+		return 0, err
+	}
+	switch relayMode {
+	case relaymode.ChatCompletions:
+		return openai.CountTokenMessages(request.Messages, request.Model), nil
+	case relaymode.Completions:
+		return openai.CountTokenInput(request.Prompt, request.Model), nil
+	}
+	return openai.CountTokenInput(request.Input, request.Model), nil
+}
+
+func setRateLimitHeaders(c *gin.Context, kind string, limit *relayRateLimit, result *common.WindowLimitResult) {
+	remaining := int64(limit.limit) - result.Used
+	if remaining < 0 {
+		remaining = 0
+	}
+	c.Header("X-Ratelimit-Limit-"+kind, strconv.Itoa(limit.limit))
+	c.Header("X-Ratelimit-Remaining-"+kind, strconv.FormatInt(remaining, 10))
+	c.Header("X-Ratelimit-Reset-"+kind, result.Reset.Round(time.Second).String())
+}
+
+// RelayRateLimit enforces the RPM, TPM and RPD of the token and the user,
+// it has to be used after TokenAuth.
+func RelayRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if relaymode.GetByPath(c.Request.URL.Path) == relaymode.Unknown {
+			// not a relay request, e.g. the estimate endpoint
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		userId := c.GetInt(ctxkey.Id)
+		// child tokens count against the limits of their parent
+		tokenId := c.GetInt(ctxkey.TokenLimitId)
+		tokenLimit, _ := c.Get(ctxkey.TokenRateLimit)
+		tokenRateLimit, _ := tokenLimit.(model.RateLimit)
+		userRateLimit, err := model.CacheGetUserRateLimit(userId)
+		if err != nil {
+			abortWithMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		limits := []*relayRateLimit{
+			{name: "令牌每分钟请求数", key: fmt.Sprintf("token:%d:rpm", tokenId), limit: tokenRateLimit.RPM, amount: 1, window: 60},
+			{name: "令牌每分钟 token 数", key: fmt.Sprintf("token:%d:tpm", tokenId), limit: tokenRateLimit.TPM, window: 60, tokens: true},
+			{name: "令牌每日请求数", key: fmt.Sprintf("token:%d:rpd", tokenId), limit: tokenRateLimit.RPD, amount: 1, window: 24 * 60 * 60},
+			{name: "用户每分钟请求数", key: fmt.Sprintf("user:%d:rpm", userId), limit: userRateLimit.RPM, amount: 1, window: 60},
+			{name: "用户每分钟 token 数", key: fmt.Sprintf("user:%d:tpm", userId), limit: userRateLimit.TPM, window: 60, tokens: true},
+			{name: "用户每日请求数", key: fmt.Sprintf("user:%d:rpd", userId), limit: userRateLimit.RPD, amount: 1, window: 24 * 60 * 60},
+		}
+		if endUser := c.GetString(ctxkey.EndUser); endUser != "" {
+			endUserLimit, _ := c.Get(ctxkey.TokenEndUserRateLimit)
+			endUserRateLimit, _ := endUserLimit.(model.RateLimit)
+			prefix := fmt.Sprintf("token:%d:end_user:%s", tokenId, endUser)
+			limits = append(limits,
+				&relayRateLimit{name: "终端用户每分钟请求数", key: prefix + ":rpm", limit: endUserRateLimit.RPM, amount: 1, window: 60},
+				&relayRateLimit{name: "终端用户每分钟 token 数", key: prefix + ":tpm", limit: endUserRateLimit.TPM, window: 60, tokens: true},
+				&relayRateLimit{name: "终端用户每日请求数", key: prefix + ":rpd", limit: endUserRateLimit.RPD, amount: 1, window: 24 * 60 * 60},
+			)
+			if quota := c.GetInt64(ctxkey.TokenEndUserQuota); quota > 0 {
+				used, err := common.WindowLimitUsage(ctx, model.EndUserQuotaLimit(tokenId, endUser, quota))
+				if err != nil {
+					logger.Error(ctx, "end user quota error: "+err.Error())
+					abortWithMessage(c, http.StatusInternalServerError, err.Error())
+					return
+				}
+				if used >= quota {
+					abortWithMessage(c, http.StatusTooManyRequests, fmt.Sprintf("终端用户 %s 已用尽 24 小时内的额度 %d，请稍后再试", endUser, quota))
+					return
+				}
+			}
+		}
+		var activeLimits []*relayRateLimit
+		var windowLimits []common.WindowLimit
+		promptTokens := -1
+		for _, limit := range limits {
+			if limit.limit <= 0 {
+				continue
+			}
+			if limit.tokens {
+				if promptTokens < 0 {
+					promptTokens, err = getPromptTokens(c)
+					if err != nil {
+						abortWithMessage(c, http.StatusBadRequest, err.Error())
+						return
+					}
+				}
+				limit.amount = int64(promptTokens)
+			}
+			activeLimits = append(activeLimits, limit)
+			windowLimits = append(windowLimits, common.WindowLimit{
+				Key:    limit.key,
+				Limit:  int64(limit.limit),
+				Amount: limit.amount,
+				Window: limit.window,
+			})
+		}
+		if len(activeLimits) == 0 {
+			c.Next()
+			return
+		}
+		allowed, results, err := common.WindowLimitRequest(ctx, windowLimits)
+		if err != nil {
+			logger.Error(ctx, "relay rate limit error: "+err.Error())
+			abortWithMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// the headers show the limit closest to being reached
+		requests, tokens := -1, -1
+		exceeded := ""
+		for i, limit := range activeLimits {
+			// usage does not include the request if it is not allowed
+			if !allowed && exceeded == "" && results[i].Used+limit.amount > int64(limit.limit) {
+				exceeded = fmt.Sprintf("%s %d", limit.name, limit.limit)
+			}
+			remaining := int64(limit.limit) - results[i].Used
+			if limit.tokens {
+				if tokens == -1 || remaining < int64(activeLimits[tokens].limit)-results[tokens].Used {
+					tokens = i
+				}
+			} else if requests == -1 || remaining < int64(activeLimits[requests].limit)-results[requests].Used {
+				requests = i
+			}
+		}
+		if requests != -1 {
+			setRateLimitHeaders(c, "Requests", activeLimits[requests], &results[requests])
+		}
+		if tokens != -1 {
+			setRateLimitHeaders(c, "Tokens", activeLimits[tokens], &results[tokens])
+		}
+		if !allowed {
+			abortWithMessage(c, http.StatusTooManyRequests, fmt.Sprintf("已达到速率限制：%s，请稍后再试", exceeded))
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,11 +1,14 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 	"strings"
 )
 
@@ -49,6 +52,19 @@ func getRequestModel(c *gin.Context) (string, error) {
 	return modelRequest.Model, nil
 }
 
+// getRequestEndUser returns the user field of the request, or "" if the
+// request has none.
+func getRequestEndUser(c *gin.Context) (string, error) {
+	var modelRequest ModelRequest
+	if err := common.UnmarshalBodyReusable(c, &modelRequest); err != nil {
+		return "", nil
+	}
+	if len(modelRequest.User) > model.MaxEndUserLength {
+		return "", fmt.Errorf("user 字段不能超过 %d 个字符", model.MaxEndUserLength)
+	}
+	return modelRequest.User, nil
+}
+
 func isModelInList(modelName string, models string) bool {
 	modelList := strings.Split(models, ",")
 	for _, model := range modelList {
@@ -58,3 +74,61 @@ func isModelInList(modelName string, models string) bool {
 	}
 	return false
 }
+
+// getRequestScope returns the token scope required by the request, or "" if
+// any token may call it.
+func getRequestScope(c *gin.Context) string {
+	path := c.Request.URL.Path
+	switch relaymode.GetByPath(path) {
+	case relaymode.ChatCompletions:
+		return model.TokenScopeChat
+	case relaymode.Completions, relaymode.Edits:
+		return model.TokenScopeCompletions
+	case relaymode.Embeddings:
+		return model.TokenScopeEmbeddings
+	case relaymode.Moderations:
+		return model.TokenScopeModerations
+	case relaymode.ImagesGenerations:
+		return model.TokenScopeImages
+	case relaymode.AudioSpeech, relaymode.AudioTranscription, relaymode.AudioTranslation:
+		return model.TokenScopeAudio
+	case relaymode.Proxy:
+		return model.TokenScopeProxy
+	}
+	if strings.HasPrefix(path, "/dashboard/billing") || strings.HasPrefix(path, "/v1/dashboard/billing") ||
+		strings.HasPrefix(path, "/v1/oneapi/estimate") {
+		return model.TokenScopeBillingRead
+	}
+	if strings.HasPrefix(path, "/v1/oneapi/tokens") {
+		return model.TokenScopeTokens
+	}
+	return ""
+}
+
+// getRequestTags merges the tags of the token with the ones of the
+// X-OneAPI-Tags header if the token allows it, the token's tags win.
+func getRequestTags(c *gin.Context, token *model.Token) (string, error) {
+	tags, err := model.ParseTags(token.GetTags())
+	if err != nil {
+		return "", err
+	}
+	header := c.Request.Header.Get("X-OneAPI-Tags")
+	if header != "" {
+		if !token.AllowRequestTags {
+			return "", errors.New("该令牌不允许通过 X-OneAPI-Tags 请求头设置标签")
+		}
+		requestTags, err := model.ParseTags(header)
+		if err != nil {
+			return "", err
+		}
+		for key, value := range requestTags {
+			if _, ok := tags[key]; !ok {
+				tags[key] = value
+			}
+		}
+		if len(tags) > model.MaxTags {
+			return "", fmt.Errorf("标签不能超过 %d 个", model.MaxTags)
+		}
+	}
+	return model.FormatTags(tags), nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/random"
 	"math/rand"
@@ -18,26 +19,37 @@ import (
 )
 
 var (
-	TokenCacheSeconds         = config.SyncFrequency
-	UserId2GroupCacheSeconds  = config.SyncFrequency
-	UserId2QuotaCacheSeconds  = config.SyncFrequency
-	UserId2StatusCacheSeconds = config.SyncFrequency
-	GroupModelsCacheSeconds   = config.SyncFrequency
+	TokenCacheSeconds              = config.SyncFrequency
+	UserId2GroupCacheSeconds       = config.SyncFrequency
+	UserId2QuotaCacheSeconds       = config.SyncFrequency
+	UserId2StatusCacheSeconds      = config.SyncFrequency
+	GroupModelsCacheSeconds        = config.SyncFrequency
+	UserId2PermissionsCacheSeconds = config.SyncFrequency
 )
 
+// CacheGetTokenByKey finds a token by its key, or by its previous key during
+// the grace period of a rotation.
 func CacheGetTokenByKey(key string) (*Token, error) {
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
 		keyCol = `"key"`
 	}
+	keyHash := common.HashTokenKey(key)
+	getToken := func(token *Token) error {
+		err := DB.Where(keyCol+" = ?", keyHash).
+			Or("previous_key_hash = ? and previous_key_expired_time > ?", keyHash, helper.GetTimestamp()).
+			First(token).Error
+		token.UsingPreviousKey = token.KeyHash != keyHash
+		return err
+	}
 	var token Token
 	if !common.RedisEnabled {
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
+		err := getToken(&token)
 		return &token, err
 	}
-	tokenObjectString, err := common.RedisGet(fmt.Sprintf("token:%s", key))
+	tokenObjectString, err := common.RedisGet(fmt.Sprintf("token:%s", keyHash))
 	if err != nil {
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
+		err := getToken(&token)
 		if err != nil {
 			return nil, err
 		}
@@ -45,7 +57,7 @@ func CacheGetTokenByKey(key string) (*Token, error) {
 		if err != nil {
 			return nil, err
 		}
-		err = common.RedisSet(fmt.Sprintf("token:%s", key), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
+		err = common.RedisSet(fmt.Sprintf("token:%s", keyHash), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
 		if err != nil {
 			logger.SysError("Redis set token error: " + err.Error())
 		}
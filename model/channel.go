@@ -38,6 +38,7 @@ type Channel struct {
 	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
 	Config             string  `json:"config"`
 	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
+	UpstreamPrices     *string `json:"upstream_prices" gorm:"type:text"` // see UpstreamPrice
 }
 
 type ChannelConfig struct {
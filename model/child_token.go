@@ -0,0 +1,156 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Child tokens are minted with a parent token through the API. Their quota is
+// carved from the parent, what they use is added to the parent's used quota,
+// and they are revoked when the parent is disabled or deleted.
+
+// MintChildToken inserts child for the owner of parent, moving the quota of
+// the child out of the parent unless the parent has unlimited quota.
+func MintChildToken(ctx context.Context, parent *Token, child *Token) error {
+	child.UserId = parent.UserId
+	child.ParentId = parent.Id
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if !parent.UnlimitedQuota {
+			result := tx.Model(&Token{}).Where("id = ? and remain_quota >= ?", parent.Id, child.RemainQuota).
+				Update("remain_quota", gorm.Expr("remain_quota - ?", child.RemainQuota))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("父令牌额度不足")
+			}
+			entry := newLedgerEntry(ctx, LedgerAccountToken, parent.Id, parent.UserId, -child.RemainQuota, LedgerReasonAllocate)
+			entry.Remark = "子令牌"
+			err := appendLedgerEntries(tx, LedgerAccountToken, parent.Id, []*QuotaLedger{entry})
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Create(child).Error
+		if err != nil {
+			return err
+		}
+		entry := newLedgerEntry(ctx, LedgerAccountToken, child.Id, child.UserId, child.RemainQuota, LedgerReasonAllocate)
+		return appendLedgerEntries(tx, LedgerAccountToken, child.Id, []*QuotaLedger{entry})
+	})
+}
+
+func GetChildTokens(parentId int) (tokens []*Token, err error) {
+	err = DB.Where("parent_id = ?", parentId).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+func GetChildToken(id int, parentId int) (*Token, error) {
+	var token Token
+	err := DB.First(&token, "id = ? and parent_id = ?", id, parentId).Error
+	return &token, err
+}
+
+// RevokeChildTokens revokes the children of parent that are enabled or still
+// hold quota, e.g. expired ones, and returns their remaining quota to it.
+func RevokeChildTokens(ctx context.Context, parent *Token) error {
+	var children []*Token
+	err := DB.Where("parent_id = ? and (status = ? or remain_quota > 0)", parent.Id, TokenStatusEnabled).Find(&children).Error
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		err = RevokeChildToken(ctx, parent, child)
+		if err != nil {
+			return fmt.Errorf("failed to revoke child token #%d: %s", child.Id, err.Error())
+		}
+	}
+	return nil
+}
+
+// RevokeChildToken disables child and returns its remaining quota to parent,
+// whatever the status of the child is.
+func RevokeChildToken(ctx context.Context, parent *Token, child *Token) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		current := Token{}
+		err := tx.Select("status", "remain_quota").First(&current, "id = ?", child.Id).Error
+		if err != nil {
+			return err
+		}
+		if current.Status == TokenStatusDisabled && current.RemainQuota == 0 {
+			// revoked already
+			return nil
+		}
+		// the condition keeps a concurrent revocation from returning the quota twice
+		result := tx.Model(&Token{}).Where("id = ? and status = ? and remain_quota = ?", child.Id, current.Status, current.RemainQuota).
+			Updates(map[string]interface{}{"status": TokenStatusDisabled, "remain_quota": 0})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("子令牌正在使用中，请稍后重试")
+		}
+		remainQuota := current.RemainQuota
+		if remainQuota <= 0 {
+			return nil
+		}
+		entry := newLedgerEntry(ctx, LedgerAccountToken, child.Id, child.UserId, -remainQuota, LedgerReasonAllocate)
+		err = appendLedgerEntries(tx, LedgerAccountToken, child.Id, []*QuotaLedger{entry})
+		if err != nil || parent.UnlimitedQuota {
+			return err
+		}
+		err = tx.Model(&Token{}).Where("id = ?", parent.Id).Update("remain_quota", gorm.Expr("remain_quota + ?", remainQuota)).Error
+		if err != nil {
+			return err
+		}
+		entry = newLedgerEntry(ctx, LedgerAccountToken, parent.Id, parent.UserId, remainQuota, LedgerReasonAllocate)
+		entry.Remark = "子令牌"
+		return appendLedgerEntries(tx, LedgerAccountToken, parent.Id, []*QuotaLedger{entry})
+	})
+	if err != nil {
+		return err
+	}
+	child.Status = TokenStatusDisabled
+	child.RemainQuota = 0
+	deleteTokenCache(child)
+	return nil
+}
+
+// deleteTokenCache makes a status change take effect before the cache expires.
+func deleteTokenCache(token *Token) {
+	if !common.RedisEnabled {
+		return
+	}
+	for _, keyHash := range []string{token.KeyHash, token.PreviousKeyHash} {
+		if keyHash == "" {
+			continue
+		}
+		err := common.RedisDel(fmt.Sprintf("token:%s", keyHash))
+		if err != nil {
+			logger.SysError("Redis del token error: " + err.Error())
+		}
+	}
+}
+
+// UpdateTokenUsedQuota adds the usage of a child token to its parent.
+func UpdateTokenUsedQuota(id int, quota int64) {
+	if config.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeTokenUsedQuota, id, quota)
+		return
+	}
+	updateTokenUsedQuota(id, quota)
+}
+
+func updateTokenUsedQuota(id int, quota int64) {
+	err := DB.Model(&Token{}).Where("id = ?", id).Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
+	if err != nil {
+		logger.SysError("failed to update token used quota: " + err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// End users are the customers of an app that calls One API with a single
+// token, told apart by the user field of OpenAI requests.
+
+const MaxEndUserLength = 64
+
+const endUserQuotaWindow = 24 * 60 * 60
+
+type endUserContextKey struct{}
+
+// WithEndUser sets the end user of the consume logs and quota recorded with ctx.
+func WithEndUser(ctx context.Context, endUser string) context.Context {
+	return context.WithValue(ctx, endUserContextKey{}, endUser)
+}
+
+func getEndUser(ctx context.Context) string {
+	endUser, _ := ctx.Value(endUserContextKey{}).(string)
+	return endUser
+}
+
+// EndUserQuotaLimit is the quota an end user may consume with a token in 24 hours.
+func EndUserQuotaLimit(tokenId int, endUser string, quota int64) common.WindowLimit {
+	return common.WindowLimit{
+		Key:    fmt.Sprintf("token:%d:end_user:%s:quota", tokenId, endUser),
+		Limit:  quota,
+		Window: endUserQuotaWindow,
+	}
+}
+
+func addEndUserQuota(ctx context.Context, token *Token, quota int64) {
+	endUser := getEndUser(ctx)
+	if endUser == "" || token.EndUserQuota <= 0 {
+		return
+	}
+	limit := EndUserQuotaLimit(token.Id, endUser, token.EndUserQuota)
+	limit.Amount = quota
+	err := common.WindowLimitAdd(ctx, limit)
+	if err != nil {
+		logger.Error(ctx, "failed to add end user quota: "+err.Error())
+	}
+}
+
+type EndUserUsage struct {
+	EndUser          string `json:"end_user"`
+	RequestCount     int    `json:"request_count"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// SumUsedQuotaByEndUser sums the consume logs matching the filters of
+// SumUsedQuota by end user, the ones who used the most quota first.
+func SumUsedQuotaByEndUser(startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, tag string, num int) (usages []*EndUserUsage, err error) {
+	err = consumeLogQuery(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tag, "").
+		Select("end_user, count(*) as request_count, sum(quota) as quota, " +
+			"sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens").
+		Where("end_user <> ''").Group("end_user").Order("quota desc").Limit(num).Scan(&usages).Error
+	return usages, err
+}
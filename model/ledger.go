@@ -0,0 +1,246 @@
+package model
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	LedgerAccountUser  = 1 // don't use 0, 0 is the default value!
+	LedgerAccountToken = 2
+)
+
+const (
+	LedgerReasonOpening    = "opening"
+	LedgerReasonRegister   = "register"
+	LedgerReasonInvite     = "invite"
+	LedgerReasonRedeem     = "redeem"
+	LedgerReasonTopUp      = "topup"
+	LedgerReasonAdmin      = "admin"
+	LedgerReasonAllocate   = "allocate" // between a parent token and its children
+	LedgerReasonLimit      = "limit"    // the owner changed the quota limit of a token
+	LedgerReasonPreConsume = "pre_consume"
+	LedgerReasonConsume    = "consume"
+	LedgerReasonRefund     = "refund"
+	LedgerReasonReconcile  = "reconcile"
+	LedgerReasonPlan       = "plan"
+	LedgerReasonReferral   = "referral"
+	LedgerReasonTransfer   = "transfer" // between a user and an organization
+)
+
+// QuotaLedger is an append-only record of a single quota movement.
+// Rows are never updated or deleted, so the sum of Delta for an account
+// must always equal its current balance.
+type QuotaLedger struct {
+	Id           int    `json:"id"`
+	AccountType  int    `json:"account_type" gorm:"index:idx_ledger_account,priority:1"`
+	AccountId    int    `json:"account_id" gorm:"index:idx_ledger_account,priority:2"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Delta        int64  `json:"delta" gorm:"bigint"`
+	BalanceAfter int64  `json:"balance_after" gorm:"bigint"`
+	Reason       string `json:"reason" gorm:"type:varchar(32);index"`
+	RequestId    string `json:"request_id" gorm:"default:''"`
+	Remark       string `json:"remark" gorm:"default:''"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func newLedgerEntry(ctx context.Context, accountType int, accountId int, userId int, delta int64, reason string) *QuotaLedger {
+	return &QuotaLedger{
+		AccountType: accountType,
+		AccountId:   accountId,
+		UserId:      userId,
+		Delta:       delta,
+		Reason:      reason,
+		RequestId:   helper.GetRequestID(ctx),
+		CreatedAt:   helper.GetTimestamp(),
+	}
+}
+
+func ledgerBalanceColumn(accountType int) (table string, column string) {
+	if accountType == LedgerAccountToken {
+		return "tokens", "remain_quota"
+	}
+	return "users", "quota"
+}
+
+// appendLedgerEntries must be called in the same transaction that applied the
+// movements. Entries are in chronological order; the balance after the last
+// one is the current balance, earlier ones are derived by walking backwards.
+func appendLedgerEntries(tx *gorm.DB, accountType int, accountId int, entries []*QuotaLedger) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	table, column := ledgerBalanceColumn(accountType)
+	var balance int64
+	err := tx.Table(table).Where("id = ?", accountId).Select(column).Scan(&balance).Error
+	if err != nil {
+		return err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entries[i].BalanceAfter = balance
+		balance -= entries[i].Delta
+	}
+	return tx.Create(&entries).Error
+}
+
+// RecordQuotaAdjustment records a movement that was applied by writing the
+// balance directly, e.g. an admin editing a user or a token.
+func RecordQuotaAdjustment(ctx context.Context, accountType int, accountId int, userId int, delta int64, reason string, remark string) {
+	if delta == 0 {
+		return
+	}
+	entry := newLedgerEntry(ctx, accountType, accountId, userId, delta, reason)
+	entry.Remark = remark
+	err := appendLedgerEntries(DB, accountType, accountId, []*QuotaLedger{entry})
+	if err != nil {
+		logger.Error(ctx, "failed to record quota ledger: "+err.Error())
+	}
+}
+
+// RecordTokenLimit records the owner changing the quota limit of a token. The
+// limit is not taken from the user's quota, so there is no second leg. A token
+// that was unlimited had no meaningful balance, the entry then brings its ledger
+// in line with the new limit.
+func RecordTokenLimit(ctx context.Context, token *Token, originRemainQuota int64, originUnlimitedQuota bool) {
+	if token.UnlimitedQuota {
+		return
+	}
+	delta := token.RemainQuota - originRemainQuota
+	if originUnlimitedQuota {
+		balance, err := SumLedgerBalance(LedgerAccountToken, token.Id)
+		if err != nil {
+			logger.Error(ctx, "failed to sum quota ledger: "+err.Error())
+			return
+		}
+		delta = token.RemainQuota - balance
+	}
+	RecordQuotaAdjustment(ctx, LedgerAccountToken, token.Id, token.UserId, delta, LedgerReasonLimit, "")
+}
+
+func GetUserLedger(userId int, accountType int, accountId int, startTimestamp int64, endTimestamp int64, startIdx int, num int) (entries []*QuotaLedger, err error) {
+	return GetAllLedger(userId, accountType, accountId, "", startTimestamp, endTimestamp, startIdx, num)
+}
+
+func GetAllLedger(userId int, accountType int, accountId int, reason string, startTimestamp int64, endTimestamp int64, startIdx int, num int) (entries []*QuotaLedger, err error) {
+	tx := DB.Model(&QuotaLedger{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if accountType != 0 {
+		tx = tx.Where("account_type = ?", accountType)
+	}
+	if accountId != 0 {
+		tx = tx.Where("account_id = ?", accountId)
+	}
+	if reason != "" {
+		tx = tx.Where("reason = ?", reason)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&entries).Error
+	return entries, err
+}
+
+func SumLedgerBalance(accountType int, accountId int) (balance int64, err error) {
+	err = DB.Model(&QuotaLedger{}).
+		Where("account_type = ? and account_id = ?", accountType, accountId).
+		Select("COALESCE(sum(delta),0)").Scan(&balance).Error
+	return balance, err
+}
+
+type LedgerReconciliation struct {
+	AccountType   int   `json:"account_type"`
+	AccountId     int   `json:"account_id"`
+	Balance       int64 `json:"balance"`
+	LedgerBalance int64 `json:"ledger_balance"`
+	Difference    int64 `json:"difference"`
+}
+
+// ReconcileLedger compares the stored balance of an account against the
+// balance derived from its ledger.
+func ReconcileLedger(accountType int, accountId int) (*LedgerReconciliation, error) {
+	table, column := ledgerBalanceColumn(accountType)
+	var balance int64
+	err := DB.Table(table).Where("id = ?", accountId).Select(column).Scan(&balance).Error
+	if err != nil {
+		return nil, err
+	}
+	ledgerBalance, err := SumLedgerBalance(accountType, accountId)
+	if err != nil {
+		return nil, err
+	}
+	return &LedgerReconciliation{
+		AccountType:   accountType,
+		AccountId:     accountId,
+		Balance:       balance,
+		LedgerBalance: ledgerBalance,
+		Difference:    balance - ledgerBalance,
+	}, nil
+}
+
+// initQuotaLedger writes an opening entry for every account that has no
+// ledger history yet, so balances that predate the ledger still reconcile.
+func initQuotaLedger() error {
+	var count int64
+	if err := DB.Model(&QuotaLedger{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count != 0 {
+		return nil
+	}
+	now := helper.GetTimestamp()
+	var users []*User
+	err := DB.Select("id", "quota").FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+		entries := make([]*QuotaLedger, 0, len(users))
+		for _, user := range users {
+			entries = append(entries, &QuotaLedger{
+				AccountType:  LedgerAccountUser,
+				AccountId:    user.Id,
+				UserId:       user.Id,
+				Delta:        user.Quota,
+				BalanceAfter: user.Quota,
+				Reason:       LedgerReasonOpening,
+				CreatedAt:    now,
+			})
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return DB.Create(&entries).Error
+	}).Error
+	if err != nil {
+		return err
+	}
+	var tokens []*Token
+	err = DB.Select("id", "user_id", "remain_quota").Where("unlimited_quota = ?", false).FindInBatches(&tokens, 500, func(tx *gorm.DB, batch int) error {
+		entries := make([]*QuotaLedger, 0, len(tokens))
+		for _, token := range tokens {
+			entries = append(entries, &QuotaLedger{
+				AccountType:  LedgerAccountToken,
+				AccountId:    token.Id,
+				UserId:       token.UserId,
+				Delta:        token.RemainQuota,
+				BalanceAfter: token.RemainQuota,
+				Reason:       LedgerReasonOpening,
+				CreatedAt:    now,
+			})
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return DB.Create(&entries).Error
+	}).Error
+	if err != nil {
+		return err
+	}
+	logger.SysLog("quota ledger initialized with opening balances")
+	return nil
+}
@@ -20,6 +20,7 @@ type Log struct {
 	Content           string `json:"content"`
 	Username          string `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
 	TokenName         string `json:"token_name" gorm:"index;default:''"`
+	TokenId           int    `json:"token_id" gorm:"index;default:0"`
 	ModelName         string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
 	Quota             int    `json:"quota" gorm:"default:0"`
 	PromptTokens      int    `json:"prompt_tokens" gorm:"default:0"`
@@ -29,6 +30,8 @@ type Log struct {
 	ElapsedTime       int64  `json:"elapsed_time" gorm:"default:0"` // unit is ms
 	IsStream          bool   `json:"is_stream" gorm:"default:false"`
 	SystemPromptReset bool   `json:"system_prompt_reset" gorm:"default:false"`
+	Tags              string `json:"tags" gorm:"type:varchar(1024);default:''"`         // see ParseTags, also saved as LogTag
+	EndUser           string `json:"end_user" gorm:"type:varchar(64);index;default:''"` // the user field of the request
 }
 
 const (
@@ -84,7 +87,16 @@ func RecordConsumeLog(ctx context.Context, log *Log) {
 	log.Username = GetUsernameById(log.UserId)
 	log.CreatedAt = helper.GetTimestamp()
 	log.Type = LogTypeConsume
+	if log.Tags == "" {
+		log.Tags = getLogTags(ctx)
+	}
+	if log.EndUser == "" {
+		log.EndUser = getEndUser(ctx)
+	}
 	recordLogHelper(ctx, log)
+	if log.Id != 0 && log.Tags != "" {
+		recordLogTags(ctx, log)
+	}
 }
 
 func RecordTestLog(ctx context.Context, log *Log) {
@@ -93,7 +105,7 @@ func RecordTestLog(ctx context.Context, log *Log) {
 	recordLogHelper(ctx, log)
 }
 
-func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int) (logs []*Log, err error) {
+func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, tag string, endUser string) (logs []*Log, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB
@@ -118,11 +130,15 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 	if channel != 0 {
 		tx = tx.Where("channel_id = ?", channel)
 	}
+	tx = whereLogTag(tx, tag)
+	if endUser != "" {
+		tx = tx.Where("end_user = ?", endUser)
+	}
 	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
 	return logs, err
 }
 
-func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int) (logs []*Log, err error) {
+func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, tag string, endUser string) (logs []*Log, err error) {
 	var tx *gorm.DB
 	if logType == LogTypeUnknown {
 		tx = LOG_DB.Where("user_id = ?", userId)
@@ -141,6 +157,10 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	if endTimestamp != 0 {
 		tx = tx.Where("created_at <= ?", endTimestamp)
 	}
+	tx = whereLogTag(tx, tag)
+	if endUser != "" {
+		tx = tx.Where("end_user = ?", endUser)
+	}
 	err = tx.Order("id desc").Limit(num).Offset(startIdx).Omit("id").Find(&logs).Error
 	return logs, err
 }
@@ -155,12 +175,19 @@ func SearchUserLogs(userId int, keyword string) (logs []*Log, err error) {
 	return logs, err
 }
 
-func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int) (quota int64) {
+func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, tag string, endUser string) (quota int64) {
 	ifnull := "ifnull"
 	if common.UsingPostgreSQL {
 		ifnull = "COALESCE"
 	}
-	tx := LOG_DB.Table("logs").Select(fmt.Sprintf("%s(sum(quota),0)", ifnull))
+	consumeLogQuery(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tag, endUser).
+		Select(fmt.Sprintf("%s(sum(quota),0)", ifnull)).Scan(&quota)
+	return quota
+}
+
+// consumeLogQuery selects the consume logs matching the filters of SumUsedQuota.
+func consumeLogQuery(startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, tag string, endUser string) *gorm.DB {
+	tx := LOG_DB.Table("logs")
 	if username != "" {
 		tx = tx.Where("username = ?", username)
 	}
@@ -179,8 +206,11 @@ func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	if channel != 0 {
 		tx = tx.Where("channel_id = ?", channel)
 	}
-	tx.Where("type = ?", LogTypeConsume).Scan(&quota)
-	return quota
+	tx = whereLogTag(tx, tag)
+	if endUser != "" {
+		tx = tx.Where("end_user = ?", endUser)
+	}
+	return tx.Where("type = ?", LogTypeConsume)
 }
 
 func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string) (token int) {
@@ -209,6 +239,10 @@ func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelNa
 }
 
 func DeleteOldLog(targetTimestamp int64) (int64, error) {
+	err := LOG_DB.Where("log_id in (?)", LOG_DB.Model(&Log{}).Select("id").Where("created_at < ?", targetTimestamp)).Delete(&LogTag{}).Error
+	if err != nil {
+		return 0, err
+	}
 	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&Log{})
 	return result.RowsAffected, result.Error
 }
@@ -222,16 +256,19 @@ type LogStatistic struct {
 	CompletionTokens int    `gorm:"column:completion_tokens"`
 }
 
-func SearchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatistic, err error) {
-	groupSelect := "DATE_FORMAT(FROM_UNIXTIME(created_at), '%Y-%m-%d') as day"
-
+// logDaySelect selects the day of created_at as "YYYY-MM-DD" into the day column.
+func logDaySelect() string {
 	if common.UsingPostgreSQL {
-		groupSelect = "TO_CHAR(date_trunc('day', to_timestamp(created_at)), 'YYYY-MM-DD') as day"
+		return "TO_CHAR(date_trunc('day', to_timestamp(created_at)), 'YYYY-MM-DD') as day"
 	}
-
 	if common.UsingSQLite {
-		groupSelect = "strftime('%Y-%m-%d', datetime(created_at, 'unixepoch')) as day"
+		return "strftime('%Y-%m-%d', datetime(created_at, 'unixepoch')) as day"
 	}
+	return "DATE_FORMAT(FROM_UNIXTIME(created_at), '%Y-%m-%d') as day"
+}
+
+func SearchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatistic, err error) {
+	groupSelect := logDaySelect()
 
 	err = LOG_DB.Raw(`
 		SELECT `+groupSelect+`,
@@ -0,0 +1,131 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Tags attribute the cost of requests to projects, cost centers and so on.
+// They are written as "key=value" pairs separated by commas, e.g.
+// "project=apollo,cost_center=cc-42", on tokens and in the X-OneAPI-Tags header.
+
+const (
+	MaxTags           = 10
+	maxTagValueLength = 64
+)
+
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,32}$`)
+
+// LogTag is a tag of a consume log, saved next to the logs so that they can
+// be filtered and summed by tag.
+type LogTag struct {
+	Id       int    `json:"id"`
+	LogId    int    `json:"log_id" gorm:"index"`
+	TagKey   string `json:"tag_key" gorm:"type:varchar(32);index:idx_log_tag_key_value,priority:1"`
+	TagValue string `json:"tag_value" gorm:"type:varchar(64);index:idx_log_tag_key_value,priority:2"`
+}
+
+func ParseTags(tagsStr string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(tagsStr, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || !tagKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("无效的标签：%s，标签格式为 key=value，key 只能包含字母、数字与 _.:-", pair)
+		}
+		if value == "" || len(value) > maxTagValueLength {
+			return nil, fmt.Errorf("标签 %s 的值不能为空且不能超过 %d 个字符", key, maxTagValueLength)
+		}
+		tags[key] = value
+	}
+	if len(tags) > MaxTags {
+		return nil, fmt.Errorf("标签不能超过 %d 个", MaxTags)
+	}
+	return tags, nil
+}
+
+// FormatTags writes tags sorted by key, so that equal tags give equal strings.
+func FormatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+tags[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+type logTagsContextKey struct{}
+
+// WithLogTags sets the tags of the consume logs recorded with ctx.
+func WithLogTags(ctx context.Context, tags string) context.Context {
+	return context.WithValue(ctx, logTagsContextKey{}, tags)
+}
+
+func getLogTags(ctx context.Context) string {
+	tags, _ := ctx.Value(logTagsContextKey{}).(string)
+	return tags
+}
+
+func recordLogTags(ctx context.Context, log *Log) {
+	tags, err := ParseTags(log.Tags)
+	if err != nil || len(tags) == 0 {
+		return
+	}
+	logTags := make([]*LogTag, 0, len(tags))
+	for key, value := range tags {
+		logTags = append(logTags, &LogTag{LogId: log.Id, TagKey: key, TagValue: value})
+	}
+	err = LOG_DB.Create(&logTags).Error
+	if err != nil {
+		logger.Error(ctx, "failed to record log tags: "+err.Error())
+	}
+}
+
+// whereLogTag filters logs by a tag given as "key" or "key=value".
+func whereLogTag(tx *gorm.DB, tag string) *gorm.DB {
+	if tag == "" {
+		return tx
+	}
+	key, value, ok := strings.Cut(tag, "=")
+	tagTx := LOG_DB.Model(&LogTag{}).Select("log_id").Where("tag_key = ?", key)
+	if ok {
+		tagTx = tagTx.Where("tag_value = ?", value)
+	}
+	return tx.Where("id in (?)", tagTx)
+}
+
+type TagUsage struct {
+	Value            string `json:"value"`
+	RequestCount     int    `json:"request_count"`
+	Quota            int64  `json:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// SumUsedQuotaByTag sums the consume logs matching the filters of
+// SumUsedQuota by the value of the tag key, logs without the key are left out.
+func SumUsedQuotaByTag(startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, tag string, endUser string, tagKey string) (usages []*TagUsage, err error) {
+	logIds := consumeLogQuery(startTimestamp, endTimestamp, modelName, username, tokenName, channel, tag, endUser).Select("id")
+	err = LOG_DB.Table("log_tags").
+		Select("log_tags.tag_value as value, count(*) as request_count, sum(logs.quota) as quota, "+
+			"sum(logs.prompt_tokens) as prompt_tokens, sum(logs.completion_tokens) as completion_tokens").
+		Joins("join logs on logs.id = log_tags.log_id").
+		Where("log_tags.tag_key = ? and log_tags.log_id in (?)", tagKey, logIds).
+		Group("log_tags.tag_value").Order("quota desc").Scan(&usages).Error
+	return usages, err
+}
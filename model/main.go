@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/songquanpeng/one-api/common"
@@ -44,12 +45,12 @@ func CreateRootAccountIfNeed() error {
 			Quota:       500000000000000,
 		}
 		DB.Create(&rootUser)
+		RecordQuotaAdjustment(context.Background(), LedgerAccountUser, rootUser.Id, rootUser.Id, rootUser.Quota, LedgerReasonRegister, "")
 		if config.InitialRootToken != "" {
 			logger.SysLog("creating initial root token as requested")
 			token := Token{
 				Id:             1,
 				UserId:         rootUser.Id,
-				Key:            config.InitialRootToken,
 				Status:         TokenStatusEnabled,
 				Name:           "Initial Root Token",
 				CreatedTime:    helper.GetTimestamp(),
@@ -58,6 +59,7 @@ func CreateRootAccountIfNeed() error {
 				RemainQuota:    500000000000000,
 				UnlimitedQuota: true,
 			}
+			token.SetKey(config.InitialRootToken)
 			DB.Create(&token)
 		}
 	}
@@ -142,6 +144,9 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Token{}); err != nil {
 		return err
 	}
+	if err = migrateTokenKeys(); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&User{}); err != nil {
 		return err
 	}
@@ -151,16 +156,55 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Redemption{}); err != nil {
 		return err
 	}
+	if err = migrateRedemptionUsedCount(); err != nil {
+		return err
+	}
 	if err = DB.AutoMigrate(&Ability{}); err != nil {
 		return err
 	}
 	if err = DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
-	if err = DB.AutoMigrate(&Channel{}); err != nil {
+	if err = DB.AutoMigrate(&LogTag{}); err != nil {
 		return err
 	}
-	return nil
+	if err = DB.AutoMigrate(&QuotaLedger{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&RedemptionRecord{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Plan{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ReferralSettlement{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&ReferralCommission{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Order{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&OrderHistory{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&MonthlyStatement{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&MonthlyStatementItem{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Organization{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&OrganizationMember{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&AdminRole{}); err != nil {
+		return err
+	}
+	return initQuotaLedger()
 }
 
 func InitLogDB() {
@@ -197,6 +241,9 @@ func migrateLOGDB() error {
 	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
 		return err
 	}
+	if err = LOG_DB.AutoMigrate(&LogTag{}); err != nil {
+		return err
+	}
 	return nil
 }
 
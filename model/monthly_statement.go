@@ -0,0 +1,248 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const StatementMonthLayout = "2006-01"
+
+// MonthlyStatement is what a user consumed and topped up in a calendar month.
+// It is generated from the logs and kept when the logs are purged.
+type MonthlyStatement struct {
+	Id               int    `json:"id"`
+	UserId           int    `json:"user_id" gorm:"uniqueIndex:idx_statement_user_month"`
+	Username         string `json:"username" gorm:"type:varchar(32);default:''"`
+	Group            string `json:"group" gorm:"type:varchar(32);default:'';index"`
+	Month            string `json:"month" gorm:"type:varchar(7);uniqueIndex:idx_statement_user_month;index"`
+	ConsumeQuota     int64  `json:"consume_quota" gorm:"bigint;default:0"`
+	TopupQuota       int64  `json:"topup_quota" gorm:"bigint;default:0"`
+	RequestCount     int    `json:"request_count" gorm:"default:0"`
+	PromptTokens     int64  `json:"prompt_tokens" gorm:"bigint;default:0"`
+	CompletionTokens int64  `json:"completion_tokens" gorm:"bigint;default:0"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint"`
+}
+
+// MonthlyStatementItem breaks a statement down by log type, model and token name.
+type MonthlyStatementItem struct {
+	Id               int    `json:"id"`
+	StatementId      int    `json:"statement_id" gorm:"index"`
+	Type             int    `json:"type"` // LogTypeConsume or LogTypeTopup
+	ModelName        string `json:"model_name" gorm:"type:varchar(128);default:''"`
+	TokenName        string `json:"token_name" gorm:"type:varchar(64);default:''"`
+	Quota            int64  `json:"quota" gorm:"bigint;default:0"`
+	RequestCount     int    `json:"request_count" gorm:"default:0"`
+	PromptTokens     int64  `json:"prompt_tokens" gorm:"bigint;default:0"`
+	CompletionTokens int64  `json:"completion_tokens" gorm:"bigint;default:0"`
+}
+
+// GroupMonthlyStatement sums the statements of the users in a group, users
+// are counted in the group they were in when the statements were generated.
+type GroupMonthlyStatement struct {
+	Group            string `json:"group"`
+	Users            int    `json:"users"`
+	ConsumeQuota     int64  `json:"consume_quota"`
+	TopupQuota       int64  `json:"topup_quota"`
+	RequestCount     int    `json:"request_count"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+type statementLogSum struct {
+	UserId           int
+	Type             int
+	ModelName        string
+	TokenName        string
+	Quota            int64
+	RequestCount     int
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+// ParseStatementMonth returns the timestamps a month starts and ends at, in local time.
+func ParseStatementMonth(month string) (start int64, end int64, err error) {
+	t, err := time.ParseInLocation(StatementMonthLayout, month, time.Local)
+	if err != nil {
+		return 0, 0, fmt.Errorf("月份格式错误，应为 %s", StatementMonthLayout)
+	}
+	return t.Unix(), t.AddDate(0, 1, 0).Unix(), nil
+}
+
+func CountMonthlyStatements(month string) (count int64, err error) {
+	err = DB.Model(&MonthlyStatement{}).Where("month = ?", month).Count(&count).Error
+	return count, err
+}
+
+// GenerateMonthlyStatements aggregates the consume and top-up logs of a finished
+// month. Existing statements of the month are only replaced with overwrite,
+// and only while the logs of the whole month are still there.
+func GenerateMonthlyStatements(ctx context.Context, month string, overwrite bool) (int, error) {
+	start, end, err := ParseStatementMonth(month)
+	if err != nil {
+		return 0, err
+	}
+	if end > helper.GetTimestamp() {
+		return 0, errors.New("该月尚未结束，无法生成账单")
+	}
+	count, err := CountMonthlyStatements(month)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 && !overwrite {
+		return 0, fmt.Errorf("%s 的账单已生成", month)
+	}
+	if count > 0 {
+		// rebuilding from partially purged logs would replace a complete statement with a partial one
+		earliest, err := earliestLogTimestamp()
+		if err != nil {
+			return 0, err
+		}
+		if earliest == 0 || earliest > start {
+			return 0, fmt.Errorf("%s 的日志已被部分清理，无法覆盖已生成的账单", month)
+		}
+	}
+	var sums []statementLogSum
+	err = LOG_DB.Model(&Log{}).
+		Select("user_id, type, model_name, token_name, sum(quota) as quota, count(*) as request_count, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens").
+		Where("created_at >= ? and created_at < ? and type in ?", start, end, []int{LogTypeConsume, LogTypeTopup}).
+		Group("user_id, type, model_name, token_name").
+		Scan(&sums).Error
+	if err != nil {
+		return 0, err
+	}
+	now := helper.GetTimestamp()
+	statements := make(map[int]*MonthlyStatement)
+	items := make(map[int][]*MonthlyStatementItem)
+	var userIds []int
+	for _, sum := range sums {
+		statement, ok := statements[sum.UserId]
+		if !ok {
+			statement = &MonthlyStatement{UserId: sum.UserId, Month: month, CreatedAt: now}
+			statements[sum.UserId] = statement
+			userIds = append(userIds, sum.UserId)
+		}
+		if sum.Type == LogTypeConsume {
+			statement.ConsumeQuota += sum.Quota
+			statement.RequestCount += sum.RequestCount
+			statement.PromptTokens += sum.PromptTokens
+			statement.CompletionTokens += sum.CompletionTokens
+		} else {
+			statement.TopupQuota += sum.Quota
+		}
+		items[sum.UserId] = append(items[sum.UserId], &MonthlyStatementItem{
+			Type:             sum.Type,
+			ModelName:        sum.ModelName,
+			TokenName:        sum.TokenName,
+			Quota:            sum.Quota,
+			RequestCount:     sum.RequestCount,
+			PromptTokens:     sum.PromptTokens,
+			CompletionTokens: sum.CompletionTokens,
+		})
+	}
+	// logs may live in another database, so users are looked up separately
+	for _, chunk := range chunkIds(userIds) {
+		var users []*User
+		err = DB.Select("id", "username", "group").Where("id in ?", chunk).Find(&users).Error
+		if err != nil {
+			return 0, err
+		}
+		for _, user := range users {
+			statements[user.Id].Username = user.Username
+			statements[user.Id].Group = user.Group
+		}
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if count > 0 {
+			err := tx.Where("statement_id in (?)", tx.Model(&MonthlyStatement{}).Select("id").Where("month = ?", month)).
+				Delete(&MonthlyStatementItem{}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Where("month = ?", month).Delete(&MonthlyStatement{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		for _, userId := range userIds {
+			statement := statements[userId]
+			err := tx.Create(statement).Error
+			if err != nil {
+				return err
+			}
+			for _, item := range items[userId] {
+				item.StatementId = statement.Id
+			}
+			err = tx.CreateInBatches(items[userId], 500).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	logger.Infof(ctx, "generated %d monthly statements of %s", len(userIds), month)
+	return len(userIds), nil
+}
+
+func GetMonthlyStatements(userId int, month string, startIdx int, num int) (statements []*MonthlyStatement, err error) {
+	tx := DB.Model(&MonthlyStatement{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if month != "" {
+		tx = tx.Where("month = ?", month)
+	}
+	tx = tx.Order("month desc, id asc")
+	if num > 0 {
+		tx = tx.Limit(num).Offset(startIdx)
+	}
+	err = tx.Find(&statements).Error
+	return statements, err
+}
+
+func GetMonthlyStatementById(id int) (*MonthlyStatement, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var statement MonthlyStatement
+	err := DB.First(&statement, "id = ?", id).Error
+	return &statement, err
+}
+
+// GetMonthlyStatementItems returns the items of the statements, keyed by statement id.
+func GetMonthlyStatementItems(statementIds []int) (map[int][]*MonthlyStatementItem, error) {
+	items := make(map[int][]*MonthlyStatementItem)
+	for _, chunk := range chunkIds(statementIds) {
+		var chunkItems []*MonthlyStatementItem
+		err := DB.Where("statement_id in ?", chunk).Order("type desc, quota desc").Find(&chunkItems).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range chunkItems {
+			items[item.StatementId] = append(items[item.StatementId], item)
+		}
+	}
+	return items, nil
+}
+
+func GetGroupMonthlyStatements(month string) (statements []*GroupMonthlyStatement, err error) {
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	err = DB.Model(&MonthlyStatement{}).
+		Select(groupCol+" as "+groupCol+", count(*) as users, sum(consume_quota) as consume_quota, sum(topup_quota) as topup_quota, sum(request_count) as request_count, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens").
+		Where("month = ?", month).Group("group").Order(groupCol).
+		Scan(&statements).Error
+	return statements, err
+}
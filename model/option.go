@@ -1,6 +1,7 @@
 package model
 
 import (
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
@@ -37,6 +38,8 @@ func InitOptionMap() {
 	config.OptionMap["ApproximateTokenEnabled"] = strconv.FormatBool(config.ApproximateTokenEnabled)
 	config.OptionMap["LogConsumeEnabled"] = strconv.FormatBool(config.LogConsumeEnabled)
 	config.OptionMap["DisplayInCurrencyEnabled"] = strconv.FormatBool(config.DisplayInCurrencyEnabled)
+	config.OptionMap["DisplayCurrency"] = config.DisplayCurrency
+	config.OptionMap["Currencies"] = common.Currencies2JSONString()
 	config.OptionMap["DisplayTokenStatEnabled"] = strconv.FormatBool(config.DisplayTokenStatEnabled)
 	config.OptionMap["ChannelDisableThreshold"] = strconv.FormatFloat(config.ChannelDisableThreshold, 'f', -1, 64)
 	config.OptionMap["EmailDomainRestrictionEnabled"] = strconv.FormatBool(config.EmailDomainRestrictionEnabled)
@@ -65,12 +68,27 @@ func InitOptionMap() {
 	config.OptionMap["QuotaForNewUser"] = strconv.FormatInt(config.QuotaForNewUser, 10)
 	config.OptionMap["QuotaForInviter"] = strconv.FormatInt(config.QuotaForInviter, 10)
 	config.OptionMap["QuotaForInvitee"] = strconv.FormatInt(config.QuotaForInvitee, 10)
+	config.OptionMap["ReferralCommissionEnabled"] = strconv.FormatBool(config.ReferralCommissionEnabled)
+	config.OptionMap["ReferralCommissionRate"] = strconv.FormatFloat(config.ReferralCommissionRate, 'f', -1, 64)
+	config.OptionMap["ReferralCommissionCapPerInvitee"] = strconv.FormatInt(config.ReferralCommissionCapPerInvitee, 10)
+	config.OptionMap["ReferralCommissionMinSpend"] = strconv.FormatInt(config.ReferralCommissionMinSpend, 10)
 	config.OptionMap["QuotaRemindThreshold"] = strconv.FormatInt(config.QuotaRemindThreshold, 10)
 	config.OptionMap["PreConsumedQuota"] = strconv.FormatInt(config.PreConsumedQuota, 10)
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
+	config.OptionMap["GroupModelRatio"] = billingratio.GroupModelRatio2JSONString()
+	config.OptionMap["ModelPriceSchedule"] = billingratio.ModelPriceSchedule2JSONString()
+	config.OptionMap["GroupRateLimits"] = GroupRateLimits2JSONString()
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
+	config.OptionMap["PaymentProvider"] = config.PaymentProvider
+	config.OptionMap["PaymentCurrency"] = config.PaymentCurrency
+	config.OptionMap["PaymentMinTopUp"] = strconv.FormatFloat(config.PaymentMinTopUp, 'f', -1, 64)
+	config.OptionMap["StripeApiAddress"] = config.StripeApiAddress
+	config.OptionMap["StripeApiSecret"] = ""
+	config.OptionMap["StripeWebhookSecret"] = ""
+	config.OptionMap["GenericPaymentAddress"] = ""
+	config.OptionMap["GenericPaymentSecret"] = ""
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
@@ -153,6 +171,8 @@ func updateOptionMap(key string, value string) (err error) {
 			config.DisplayInCurrencyEnabled = boolValue
 		case "DisplayTokenStatEnabled":
 			config.DisplayTokenStatEnabled = boolValue
+		case "ReferralCommissionEnabled":
+			config.ReferralCommissionEnabled = boolValue
 		}
 	}
 	switch key {
@@ -217,6 +237,12 @@ func updateOptionMap(key string, value string) (err error) {
 		config.QuotaForInviter, _ = strconv.ParseInt(value, 10, 64)
 	case "QuotaForInvitee":
 		config.QuotaForInvitee, _ = strconv.ParseInt(value, 10, 64)
+	case "ReferralCommissionRate":
+		config.ReferralCommissionRate, _ = strconv.ParseFloat(value, 64)
+	case "ReferralCommissionCapPerInvitee":
+		config.ReferralCommissionCapPerInvitee, _ = strconv.ParseInt(value, 10, 64)
+	case "ReferralCommissionMinSpend":
+		config.ReferralCommissionMinSpend, _ = strconv.ParseInt(value, 10, 64)
 	case "QuotaRemindThreshold":
 		config.QuotaRemindThreshold, _ = strconv.ParseInt(value, 10, 64)
 	case "PreConsumedQuota":
@@ -227,10 +253,36 @@ func updateOptionMap(key string, value string) (err error) {
 		err = billingratio.UpdateModelRatioByJSONString(value)
 	case "GroupRatio":
 		err = billingratio.UpdateGroupRatioByJSONString(value)
+	case "GroupModelRatio":
+		err = billingratio.UpdateGroupModelRatioByJSONString(value)
+	case "ModelPriceSchedule":
+		err = billingratio.UpdateModelPriceScheduleByJSONString(value)
+	case "GroupRateLimits":
+		err = UpdateGroupRateLimitsByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "DisplayCurrency":
+		config.DisplayCurrency = value
+	case "Currencies":
+		err = common.UpdateCurrenciesByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
+	case "PaymentProvider":
+		config.PaymentProvider = value
+	case "PaymentCurrency":
+		config.PaymentCurrency = strings.ToLower(value)
+	case "PaymentMinTopUp":
+		config.PaymentMinTopUp, _ = strconv.ParseFloat(value, 64)
+	case "StripeApiAddress":
+		config.StripeApiAddress = value
+	case "StripeApiSecret":
+		config.StripeApiSecret = value
+	case "StripeWebhookSecret":
+		config.StripeWebhookSecret = value
+	case "GenericPaymentAddress":
+		config.GenericPaymentAddress = value
+	case "GenericPaymentSecret":
+		config.GenericPaymentSecret = value
 	case "ChatLink":
 		config.ChatLink = value
 	case "ChannelDisableThreshold":
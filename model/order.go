@@ -0,0 +1,184 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+const (
+	OrderStatusPending = 1 // don't use 0, 0 is the default value!
+	OrderStatusPaid    = 2
+	OrderStatusFailed  = 3
+)
+
+// Order is a self-service top-up paid through a payment provider.
+type Order struct {
+	Id              int    `json:"id"`
+	TradeNo         string `json:"trade_no" gorm:"type:varchar(64);uniqueIndex"`
+	UserId          int    `json:"user_id" gorm:"index"`
+	Provider        string `json:"provider" gorm:"type:varchar(32)"`
+	ProviderOrderId string `json:"provider_order_id" gorm:"type:varchar(255);index"`
+	Amount          int64  `json:"amount" gorm:"bigint"` // in the smallest currency unit, e.g. cents
+	Currency        string `json:"currency" gorm:"type:varchar(8)"`
+	Quota           int64  `json:"quota" gorm:"bigint"`
+	Status          int    `json:"status" gorm:"default:1;index"`
+	CreatedTime     int64  `json:"created_time" gorm:"bigint"`
+	PaidTime        int64  `json:"paid_time" gorm:"bigint"`
+}
+
+// OrderHistory records every status change of an order.
+type OrderHistory struct {
+	Id        int    `json:"id"`
+	OrderId   int    `json:"order_id" gorm:"index"`
+	Status    int    `json:"status"`
+	Remark    string `json:"remark" gorm:"type:text"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+}
+
+func newOrderHistory(orderId int, status int, remark string) *OrderHistory {
+	return &OrderHistory{
+		OrderId:   orderId,
+		Status:    status,
+		Remark:    remark,
+		CreatedAt: helper.GetTimestamp(),
+	}
+}
+
+func (order *Order) Insert() error {
+	order.Status = OrderStatusPending
+	order.CreatedTime = helper.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(order).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(newOrderHistory(order.Id, OrderStatusPending, "created")).Error
+	})
+}
+
+func (order *Order) UpdateProviderOrderId(providerOrderId string) error {
+	order.ProviderOrderId = providerOrderId
+	return DB.Model(order).Update("provider_order_id", providerOrderId).Error
+}
+
+func GetOrderByTradeNo(tradeNo string) (*Order, error) {
+	if tradeNo == "" {
+		return nil, errors.New("订单号为空！")
+	}
+	var order Order
+	err := DB.First(&order, "trade_no = ?", tradeNo).Error
+	return &order, err
+}
+
+func GetOrderById(id int) (*Order, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var order Order
+	err := DB.First(&order, "id = ?", id).Error
+	return &order, err
+}
+
+func GetUserOrders(userId int, startIdx int, num int) (orders []*Order, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&orders).Error
+	return orders, err
+}
+
+func GetAllOrders(userId int, status int, startIdx int, num int) (orders []*Order, err error) {
+	tx := DB.Model(&Order{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != 0 {
+		tx = tx.Where("status = ?", status)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&orders).Error
+	return orders, err
+}
+
+func GetOrderHistory(orderId int) (history []*OrderHistory, err error) {
+	err = DB.Where("order_id = ?", orderId).Order("id asc").Find(&history).Error
+	return history, err
+}
+
+// CompleteOrder credits the quota of a paid order. Providers may deliver the
+// same webhook more than once, only the first delivery moves a pending order
+// to paid, so the quota is credited exactly once. The webhook must come from
+// the provider the order was created with.
+func CompleteOrder(ctx context.Context, provider string, tradeNo string, providerOrderId string, amount int64, currency string) error {
+	order, err := GetOrderByTradeNo(tradeNo)
+	if err != nil {
+		return err
+	}
+	if provider != order.Provider {
+		return fmt.Errorf("订单 %s 不是通过 %s 创建的", order.TradeNo, provider)
+	}
+	if order.Status == OrderStatusPaid {
+		return nil
+	}
+	if amount != order.Amount || !strings.EqualFold(currency, order.Currency) {
+		return fmt.Errorf("支付金额 %d %s 与订单金额 %d %s 不符", amount, currency, order.Amount, order.Currency)
+	}
+	credited := false
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"status":    OrderStatusPaid,
+			"paid_time": helper.GetTimestamp(),
+		}
+		if providerOrderId != "" {
+			updates["provider_order_id"] = providerOrderId
+		}
+		result := tx.Model(&Order{}).Where("id = ? and status = ?", order.Id, OrderStatusPending).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// paid by a concurrent delivery, or failed already
+			return nil
+		}
+		err := tx.Model(&User{}).Where("id = ?", order.UserId).Update("quota", gorm.Expr("quota + ?", order.Quota)).Error
+		if err != nil {
+			return err
+		}
+		entry := newLedgerEntry(ctx, LedgerAccountUser, order.UserId, order.UserId, order.Quota, LedgerReasonTopUp)
+		entry.Remark = fmt.Sprintf("order %s", order.TradeNo)
+		err = appendLedgerEntries(tx, LedgerAccountUser, order.UserId, []*QuotaLedger{entry})
+		if err != nil {
+			return err
+		}
+		credited = true
+		return tx.Create(newOrderHistory(order.Id, OrderStatusPaid, fmt.Sprintf("paid via %s", order.Provider))).Error
+	})
+	if err != nil {
+		return err
+	}
+	if credited {
+		RecordTopupLog(ctx, order.UserId, fmt.Sprintf("通过在线支付充值 %s，订单号：%s", common.LogQuota(order.Quota), order.TradeNo), int(order.Quota))
+	}
+	return nil
+}
+
+// FailOrder closes a pending order, paid orders are never failed afterwards.
+func FailOrder(provider string, tradeNo string, remark string) error {
+	order, err := GetOrderByTradeNo(tradeNo)
+	if err != nil {
+		return err
+	}
+	if provider != order.Provider {
+		return fmt.Errorf("订单 %s 不是通过 %s 创建的", order.TradeNo, provider)
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Order{}).Where("id = ? and status = ?", order.Id, OrderStatusPending).Update("status", OrderStatusFailed)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Create(newOrderHistory(order.Id, OrderStatusFailed, remark)).Error
+	})
+}
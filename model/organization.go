@@ -0,0 +1,382 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+	OrganizationRoleViewer = "viewer"
+)
+
+// organizationRoleRanks orders the roles, a role may do everything the roles below it may do
+var organizationRoleRanks = map[string]int{
+	OrganizationRoleViewer: 1,
+	OrganizationRoleMember: 2,
+	OrganizationRoleAdmin:  3,
+	OrganizationRoleOwner:  4,
+}
+
+// Organization shares a quota pool, tokens and logs between its members.
+// They belong to the account of the organization, a user that can not log in,
+// so billing works the same as for personal accounts.
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex"` // the account of the organization
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	// filled from the account and the membership of the current user
+	Quota     int64  `json:"quota" gorm:"-"`
+	UsedQuota int64  `json:"used_quota" gorm:"-"`
+	Role      string `json:"role,omitempty" gorm:"-"`
+}
+
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_organization_member,priority:1"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_organization_member,priority:2;index"`
+	Role           string `json:"role" gorm:"type:varchar(16)"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	Username       string `json:"username" gorm:"-"`
+}
+
+func IsValidOrganizationRole(role string) bool {
+	_, ok := organizationRoleRanks[role]
+	return ok
+}
+
+// OrganizationRoleAtLeast reports whether role may do what minRole may do.
+func OrganizationRoleAtLeast(role string, minRole string) bool {
+	rank, ok := organizationRoleRanks[role]
+	return ok && rank >= organizationRoleRanks[minRole]
+}
+
+func (organization *Organization) fillQuota() error {
+	var user User
+	err := DB.Select("quota", "used_quota").First(&user, "id = ?", organization.UserId).Error
+	if err != nil {
+		return err
+	}
+	organization.Quota = user.Quota
+	organization.UsedQuota = user.UsedQuota
+	return nil
+}
+
+// CreateOrganization creates an organization with its account, ownerId becomes its owner.
+func CreateOrganization(name string, ownerId int) (*Organization, error) {
+	if name == "" || len(name) > 64 {
+		return nil, errors.New("组织名称不能为空且不能超过 64 个字符")
+	}
+	owner, err := GetUserById(ownerId, false)
+	if err != nil {
+		return nil, errors.New("所有者不存在")
+	}
+	if owner.OrganizationId != 0 || owner.Status != UserStatusEnabled {
+		return nil, errors.New("所有者必须是已启用的个人账户")
+	}
+	if DB.Where("name = ?", name).Find(&Organization{}).RowsAffected != 0 {
+		return nil, errors.New("组织名称已存在")
+	}
+	// nobody knows the password, the account is only used through its organization
+	password, err := common.Password2Hash(random.GetUUID())
+	if err != nil {
+		return nil, err
+	}
+	now := helper.GetTimestamp()
+	organization := &Organization{
+		Name:        name,
+		CreatedTime: now,
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		user := &User{
+			Username:    "org_" + random.GetRandomString(8),
+			Password:    password,
+			DisplayName: name,
+			Role:        RoleCommonUser,
+			Status:      UserStatusEnabled,
+			AccessToken: random.GetUUID(),
+			AffCode:     random.GetRandomString(8),
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		organization.UserId = user.Id
+		if err := tx.Create(organization).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("organization_id", organization.Id).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationId: organization.Id,
+			UserId:         ownerId,
+			Role:           OrganizationRoleOwner,
+			CreatedTime:    now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	organization.Role = OrganizationRoleOwner
+	return organization, nil
+}
+
+func GetAllOrganizations(startIdx int, num int) (organizations []*Organization, err error) {
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&organizations).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, organization := range organizations {
+		if err = organization.fillQuota(); err != nil {
+			return nil, err
+		}
+	}
+	return organizations, nil
+}
+
+// GetUserOrganizations returns the organizations the user is a member of, with the role of the user.
+func GetUserOrganizations(userId int) ([]*Organization, error) {
+	var members []*OrganizationMember
+	err := DB.Where("user_id = ?", userId).Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	organizations := make([]*Organization, 0, len(members))
+	for _, member := range members {
+		organization, err := GetOrganizationById(member.OrganizationId)
+		if err != nil {
+			return nil, err
+		}
+		organization.Role = member.Role
+		organizations = append(organizations, organization)
+	}
+	return organizations, nil
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	organization := Organization{}
+	err := DB.First(&organization, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	err = organization.fillQuota()
+	return &organization, err
+}
+
+// GetOrganizationMembership returns the organization and the role of the user in it.
+func GetOrganizationMembership(organizationId int, userId int) (*Organization, string, error) {
+	member := OrganizationMember{}
+	err := DB.First(&member, "organization_id = ? and user_id = ?", organizationId, userId).Error
+	if err != nil {
+		return nil, "", errors.New("组织不存在或您不是该组织成员")
+	}
+	organization, err := GetOrganizationById(organizationId)
+	if err != nil {
+		return nil, "", err
+	}
+	organization.Role = member.Role
+	return organization, member.Role, nil
+}
+
+func GetOrganizationMembers(organizationId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	err := DB.Where("organization_id = ?", organizationId).Order("id asc").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		user := User{}
+		if DB.Select("username").First(&user, "id = ?", member.UserId).Error == nil {
+			member.Username = user.Username
+		}
+	}
+	return members, nil
+}
+
+// checkOrganizationRoleChange makes sure operatorRole may change a member from
+// role to newRole, an empty role is a new member and an empty newRole a removed one.
+// Only owners grant or revoke the owner role, and the last owner can not leave.
+func checkOrganizationRoleChange(tx *gorm.DB, organizationId int, operatorRole string, role string, newRole string) error {
+	if newRole != "" && !IsValidOrganizationRole(newRole) {
+		return fmt.Errorf("无效的组织角色：%s", newRole)
+	}
+	if (role == OrganizationRoleOwner || newRole == OrganizationRoleOwner) && operatorRole != OrganizationRoleOwner {
+		return errors.New("只有所有者可以授予或撤销所有者角色")
+	}
+	if role == OrganizationRoleOwner && newRole != OrganizationRoleOwner {
+		var owners int64
+		err := tx.Model(&OrganizationMember{}).Where("organization_id = ? and role = ?", organizationId, OrganizationRoleOwner).Count(&owners).Error
+		if err != nil {
+			return err
+		}
+		if owners <= 1 {
+			return errors.New("组织至少需要保留一名所有者")
+		}
+	}
+	return nil
+}
+
+func AddOrganizationMember(organizationId int, operatorRole string, userId int, role string) (*OrganizationMember, error) {
+	user, err := GetUserById(userId, false)
+	if err != nil || user.Status == UserStatusDeleted {
+		return nil, errors.New("用户不存在")
+	}
+	if user.OrganizationId != 0 {
+		return nil, errors.New("组织账户不能成为组织成员")
+	}
+	member := &OrganizationMember{
+		OrganizationId: organizationId,
+		UserId:         userId,
+		Role:           role,
+		CreatedTime:    helper.GetTimestamp(),
+		Username:       user.Username,
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkOrganizationRoleChange(tx, organizationId, operatorRole, "", role); err != nil {
+			return err
+		}
+		if tx.Where("organization_id = ? and user_id = ?", organizationId, userId).Find(&OrganizationMember{}).RowsAffected != 0 {
+			return errors.New("该用户已是组织成员")
+		}
+		return tx.Create(member).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// UpdateOrganizationMember changes the role of a member, the tokens of a member
+// demoted to viewer are disabled as viewers can not use tokens.
+func UpdateOrganizationMember(organizationId int, operatorRole string, userId int, role string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		member := OrganizationMember{}
+		if err := tx.First(&member, "organization_id = ? and user_id = ?", organizationId, userId).Error; err != nil {
+			return errors.New("该用户不是组织成员")
+		}
+		if err := checkOrganizationRoleChange(tx, organizationId, operatorRole, member.Role, role); err != nil {
+			return err
+		}
+		return tx.Model(&member).Update("role", role).Error
+	})
+	if err != nil || OrganizationRoleAtLeast(role, OrganizationRoleMember) {
+		return err
+	}
+	return disableOrganizationMemberTokens(organizationId, userId)
+}
+
+// DeleteOrganizationMember removes a member and disables the tokens they created.
+func DeleteOrganizationMember(organizationId int, operatorRole string, userId int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		member := OrganizationMember{}
+		if err := tx.First(&member, "organization_id = ? and user_id = ?", organizationId, userId).Error; err != nil {
+			return errors.New("该用户不是组织成员")
+		}
+		if err := checkOrganizationRoleChange(tx, organizationId, operatorRole, member.Role, ""); err != nil {
+			return err
+		}
+		return tx.Delete(&member).Error
+	})
+	if err != nil {
+		return err
+	}
+	return disableOrganizationMemberTokens(organizationId, userId)
+}
+
+// disableOrganizationMemberTokens disables the tokens a member created under the
+// account of the organization, their child tokens are revoked with them.
+func disableOrganizationMemberTokens(organizationId int, userId int) error {
+	organization, err := GetOrganizationById(organizationId)
+	if err != nil {
+		return err
+	}
+	var tokens []*Token
+	err = DB.Where("user_id = ? and creator_id = ? and parent_id = 0 and status = ?",
+		organization.UserId, userId, TokenStatusEnabled).Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		err = DB.Model(token).Update("status", TokenStatusDisabled).Error
+		if err != nil {
+			return err
+		}
+		deleteTokenCache(token)
+		err = RevokeChildTokens(context.Background(), token)
+		if err != nil {
+			return err
+		}
+	}
+	if len(tokens) > 0 {
+		logger.SysLog(fmt.Sprintf("disabled %d tokens of user %d in organization %d", len(tokens), userId, organizationId))
+	}
+	return nil
+}
+
+// transferUserQuota moves quota between two accounts, the remarks of the
+// ledger entries name the other side.
+func transferUserQuota(ctx context.Context, fromId int, toId int, quota int64, fromRemark string, toRemark string) error {
+	if quota <= 0 {
+		return errors.New("划转额度必须大于 0")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? and quota >= ?", fromId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("额度不足")
+		}
+		err := tx.Model(&User{}).Where("id = ?", toId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+		if err != nil {
+			return err
+		}
+		entry := newLedgerEntry(ctx, LedgerAccountUser, fromId, fromId, -quota, LedgerReasonTransfer)
+		entry.Remark = fromRemark
+		if err := appendLedgerEntries(tx, LedgerAccountUser, fromId, []*QuotaLedger{entry}); err != nil {
+			return err
+		}
+		entry = newLedgerEntry(ctx, LedgerAccountUser, toId, toId, quota, LedgerReasonTransfer)
+		entry.Remark = toRemark
+		return appendLedgerEntries(tx, LedgerAccountUser, toId, []*QuotaLedger{entry})
+	})
+}
+
+// TransferQuotaToOrganization moves quota from a member's personal account to the pool of the organization.
+func TransferQuotaToOrganization(ctx context.Context, userId int, organization *Organization, quota int64) error {
+	err := transferUserQuota(ctx, userId, organization.UserId, quota,
+		fmt.Sprintf("组织 %d", organization.Id), fmt.Sprintf("用户 %d", userId))
+	if err != nil {
+		return err
+	}
+	RecordLog(ctx, userId, LogTypeManage, fmt.Sprintf("向组织 %s 划转 %s", organization.Name, common.LogQuota(quota)))
+	RecordTopupLog(ctx, organization.UserId, fmt.Sprintf("用户 %d 划转 %s", userId, common.LogQuota(quota)), int(quota))
+	return nil
+}
+
+// TransferQuotaFromOrganization moves quota from the pool of the organization
+// back to the personal account of a member.
+func TransferQuotaFromOrganization(ctx context.Context, userId int, organization *Organization, quota int64) error {
+	err := transferUserQuota(ctx, organization.UserId, userId, quota,
+		fmt.Sprintf("用户 %d", userId), fmt.Sprintf("组织 %d", organization.Id))
+	if err != nil {
+		return err
+	}
+	RecordLog(ctx, organization.UserId, LogTypeManage, fmt.Sprintf("用户 %d 从组织额度池转出 %s", userId, common.LogQuota(quota)))
+	RecordTopupLog(ctx, userId, fmt.Sprintf("从组织 %s 转出 %s", organization.Name, common.LogQuota(quota)), int(quota))
+	return nil
+}
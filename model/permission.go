@@ -0,0 +1,252 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// permissions of the admin API, see PermissionAuth in the middleware
+const (
+	PermissionChannelRead        = "channel:read"
+	PermissionChannelWrite       = "channel:write"
+	PermissionChannelKeyRead     = "channel:key:read"
+	PermissionUserRead           = "user:read"
+	PermissionUserManage         = "user:manage"
+	PermissionLogRead            = "log:read"
+	PermissionLogWrite           = "log:write"
+	PermissionRedemptionRead     = "redemption:read"
+	PermissionRedemptionWrite    = "redemption:write"
+	PermissionBillingRead        = "billing:read"
+	PermissionBillingWrite       = "billing:write"
+	PermissionOrganizationManage = "organization:manage"
+	PermissionOptionRead         = "option:read"
+	PermissionOptionWrite        = "option:write"
+	PermissionRoleManage         = "role:manage"
+)
+
+var Permissions = []string{PermissionChannelRead, PermissionChannelWrite, PermissionChannelKeyRead,
+	PermissionUserRead, PermissionUserManage, PermissionLogRead, PermissionLogWrite,
+	PermissionRedemptionRead, PermissionRedemptionWrite, PermissionBillingRead, PermissionBillingWrite,
+	PermissionOrganizationManage, PermissionOptionRead, PermissionOptionWrite, PermissionRoleManage}
+
+// rootPermissions are only held by root users by default, admins have the others
+var rootPermissions = []string{PermissionOptionRead, PermissionOptionWrite, PermissionRoleManage}
+
+// AdminRole bundles permissions, a user with a role has exactly its permissions
+// instead of the default ones of RoleAdminUser. Root users always have all of them.
+type AdminRole struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(32);uniqueIndex"`
+	Description string `json:"description" gorm:"default:''"`
+	Permissions string `json:"permissions" gorm:"type:varchar(1024);default:''"` // comma separated
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+func containsPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func IsValidPermission(permission string) bool {
+	return containsPermission(Permissions, permission)
+}
+
+func (role *AdminRole) GetPermissions() []string {
+	if role.Permissions == "" {
+		return []string{}
+	}
+	return strings.Split(role.Permissions, ",")
+}
+
+// normalize validates the role and removes duplicated permissions
+func (role *AdminRole) normalize() error {
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" || len(role.Name) > 32 {
+		return errors.New("角色名称不能为空且不能超过 32 个字符")
+	}
+	set := make(map[string]bool)
+	for _, permission := range strings.Split(role.Permissions, ",") {
+		permission = strings.TrimSpace(permission)
+		if permission == "" {
+			continue
+		}
+		if !IsValidPermission(permission) {
+			return fmt.Errorf("无效的权限：%s", permission)
+		}
+		set[permission] = true
+	}
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	role.Permissions = strings.Join(permissions, ",")
+	return nil
+}
+
+func GetAllAdminRoles() (roles []*AdminRole, err error) {
+	err = DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+func GetAdminRoleById(id int) (*AdminRole, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	role := AdminRole{}
+	err := DB.First(&role, "id = ?", id).Error
+	return &role, err
+}
+
+func (role *AdminRole) Insert() error {
+	if err := role.normalize(); err != nil {
+		return err
+	}
+	role.CreatedTime = helper.GetTimestamp()
+	return DB.Create(role).Error
+}
+
+func (role *AdminRole) Update() error {
+	if err := role.normalize(); err != nil {
+		return err
+	}
+	err := DB.Model(role).Select("name", "description", "permissions").Updates(role).Error
+	if err != nil {
+		return err
+	}
+	var userIds []int
+	err = DB.Model(&User{}).Where("admin_role_id = ?", role.Id).Pluck("id", &userIds).Error
+	if err != nil {
+		return err
+	}
+	deleteUserPermissionsCache(userIds...)
+	return nil
+}
+
+// DeleteAdminRoleById deletes a role, its users fall back to the default permissions of their role.
+func DeleteAdminRoleById(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	var userIds []int
+	err := DB.Model(&User{}).Where("admin_role_id = ?", id).Pluck("id", &userIds).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Model(&User{}).Where("admin_role_id = ?", id).Update("admin_role_id", 0).Error
+	if err != nil {
+		return err
+	}
+	deleteUserPermissionsCache(userIds...)
+	return DB.Delete(&AdminRole{Id: id}).Error
+}
+
+// SetUserAdminRole assigns a role to a user, 0 restores the default permissions.
+// Only admins can have a role, the user management APIs compare the levels of
+// users, so a common user with a role could not manage anyone.
+func SetUserAdminRole(userId int, roleId int) error {
+	if roleId != 0 {
+		if _, err := GetAdminRoleById(roleId); err != nil {
+			return errors.New("角色不存在")
+		}
+	}
+	user, err := GetUserById(userId, false)
+	if err != nil || user.Status == UserStatusDeleted {
+		return errors.New("用户不存在")
+	}
+	if roleId != 0 && user.Role < RoleAdminUser {
+		return errors.New("只能为管理员分配角色")
+	}
+	err = DB.Model(user).Update("admin_role_id", roleId).Error
+	if err != nil {
+		return err
+	}
+	deleteUserPermissionsCache(userId)
+	return nil
+}
+
+// GetUserPermissions returns the permissions of a user with the given role,
+// users below RoleAdminUser have none even if they were assigned a role.
+func GetUserPermissions(userId int, role int) ([]string, error) {
+	if role >= RoleRootUser {
+		return Permissions, nil
+	}
+	if role < RoleAdminUser {
+		return []string{}, nil
+	}
+	var adminRoleId int
+	err := DB.Model(&User{}).Where("id = ?", userId).Select("admin_role_id").Find(&adminRoleId).Error
+	if err != nil {
+		return nil, err
+	}
+	if adminRoleId != 0 {
+		adminRole, err := GetAdminRoleById(adminRoleId)
+		if err != nil {
+			return []string{}, nil
+		}
+		return adminRole.GetPermissions(), nil
+	}
+	permissions := make([]string, 0, len(Permissions))
+	for _, permission := range Permissions {
+		if !containsPermission(rootPermissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions, nil
+}
+
+// CacheGetUserPermissions caches the permissions of admins, they are checked
+// on every request to the admin API.
+func CacheGetUserPermissions(userId int, role int) ([]string, error) {
+	if !common.RedisEnabled || role >= RoleRootUser || role < RoleAdminUser {
+		return GetUserPermissions(userId, role)
+	}
+	key := fmt.Sprintf("user_permissions:%d", userId)
+	permissions, err := common.RedisGet(key)
+	if err != nil {
+		result, err := GetUserPermissions(userId, role)
+		if err != nil {
+			return nil, err
+		}
+		err = common.RedisSet(key, strings.Join(result, ","), time.Duration(UserId2PermissionsCacheSeconds)*time.Second)
+		if err != nil {
+			logger.SysError("Redis set user permissions error: " + err.Error())
+		}
+		return result, nil
+	}
+	if permissions == "" {
+		return []string{}, nil
+	}
+	return strings.Split(permissions, ","), nil
+}
+
+func deleteUserPermissionsCache(userIds ...int) {
+	if !common.RedisEnabled {
+		return
+	}
+	for _, userId := range userIds {
+		err := common.RedisDel(fmt.Sprintf("user_permissions:%d", userId))
+		if err != nil {
+			logger.SysError("failed to delete user permissions cache: " + err.Error())
+		}
+	}
+}
+
+func HasPermission(userId int, role int, permission string) bool {
+	permissions, err := CacheGetUserPermissions(userId, role)
+	if err != nil {
+		return false
+	}
+	return containsPermission(permissions, permission)
+}
@@ -0,0 +1,316 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	PlanStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	PlanStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	PlanPeriodDay   = "day"
+	PlanPeriodWeek  = "week"
+	PlanPeriodMonth = "month"
+)
+
+// Plan grants Quota to each subscriber every Period. Without CarryOver, what is
+// left of a grant is taken back when the next one is made or the plan ends.
+type Plan struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:text"`
+	Status      int    `json:"status" gorm:"default:1"`
+	Quota       int64  `json:"quota" gorm:"bigint;default:0"`
+	Period      string `json:"period" gorm:"type:varchar(16);default:'month'"`
+	CarryOver   bool   `json:"carry_over" gorm:"default:false"`
+	Group       string `json:"group" gorm:"type:varchar(32);default:''"` // subscribers are moved to this group, empty means unchanged
+	Duration    int    `json:"duration" gorm:"default:0"`                // in days, 0 means never expires
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+func IsValidPlanPeriod(period string) bool {
+	switch period {
+	case PlanPeriodDay, PlanPeriodWeek, PlanPeriodMonth:
+		return true
+	}
+	return false
+}
+
+func nextPlanGrantTime(period string, from int64) int64 {
+	t := time.Unix(from, 0)
+	switch period {
+	case PlanPeriodDay:
+		return t.AddDate(0, 0, 1).Unix()
+	case PlanPeriodWeek:
+		return t.AddDate(0, 0, 7).Unix()
+	default:
+		return t.AddDate(0, 1, 0).Unix()
+	}
+}
+
+func GetAllPlans(startIdx int, num int) ([]*Plan, error) {
+	var plans []*Plan
+	err := DB.Order("id desc").Limit(num).Offset(startIdx).Find(&plans).Error
+	return plans, err
+}
+
+func GetPlanById(id int) (*Plan, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	plan := Plan{Id: id}
+	err := DB.First(&plan, "id = ?", id).Error
+	return &plan, err
+}
+
+func (plan *Plan) Insert() error {
+	plan.CreatedTime = helper.GetTimestamp()
+	return DB.Create(plan).Error
+}
+
+// Update Make sure your plan's fields are completed, because this will update zero values
+func (plan *Plan) Update() error {
+	return DB.Model(plan).Select("name", "description", "status", "quota", "period", "carry_over", "group", "duration").Updates(plan).Error
+}
+
+func DeletePlanById(id int) error {
+	if id == 0 {
+		return errors.New("id 为空！")
+	}
+	var count int64
+	err := DB.Model(&User{}).Where("plan_id = ?", id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("仍有 %d 个用户订阅该套餐，无法删除", count)
+	}
+	return DB.Delete(&Plan{Id: id}).Error
+}
+
+func invalidateUserGroupCache(userId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	err := common.RedisDel(fmt.Sprintf("user_group:%d", userId))
+	if err != nil {
+		logger.SysError("Redis delete user group error: " + err.Error())
+	}
+}
+
+// unusedPlanQuota is what is left of the latest grant,
+// assuming usage since the grant was paid from it first.
+func unusedPlanQuota(user *User, plan *Plan) int64 {
+	if plan.CarryOver || user.PlanGrantedQuota <= 0 {
+		return 0
+	}
+	unused := user.PlanGrantedQuota - (user.UsedQuota - user.PlanUsedQuotaMark)
+	if unused > user.Quota {
+		unused = user.Quota
+	}
+	if unused <= 0 {
+		return 0
+	}
+	return unused
+}
+
+// forfeitUnusedPlanQuota takes back what is left of the latest grant.
+func forfeitUnusedPlanQuota(ctx context.Context, user *User, plan *Plan) {
+	unused := unusedPlanQuota(user, plan)
+	if unused <= 0 {
+		return
+	}
+	err := DecreaseUserQuota(ctx, user.Id, unused, LedgerReasonPlan)
+	if err != nil {
+		logger.Error(ctx, fmt.Sprintf("failed to forfeit plan quota of user %d: %s", user.Id, err.Error()))
+		return
+	}
+	RecordLog(ctx, user.Id, LogTypeManage, fmt.Sprintf("套餐 %s 本期未使用的额度 %s 已清零", plan.Name, common.LogQuota(unused)))
+}
+
+var errPlanQuotaGranted = errors.New("套餐额度已由其他任务发放")
+
+// grantPlanQuota forfeits the unused quota of the latest grant and makes the next one
+// in a single transaction, guarded by the grant time the user was read with.
+func grantPlanQuota(ctx context.Context, user *User, plan *Plan) error {
+	unused := unusedPlanQuota(user, plan)
+	now := helper.GetTimestamp()
+	next := user.PlanNextGrantTime
+	if next == 0 {
+		next = now
+	}
+	// periods missed while the scheduler was down are not granted again
+	for next <= now {
+		next = nextPlanGrantTime(plan.Period, next)
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? and plan_id = ? and plan_next_grant_time = ?", user.Id, plan.Id, user.PlanNextGrantTime).Updates(map[string]interface{}{
+			"quota":                gorm.Expr("quota + ?", plan.Quota-unused),
+			"plan_next_grant_time": next,
+			"plan_granted_quota":   plan.Quota,
+			"plan_used_quota_mark": gorm.Expr("used_quota"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPlanQuotaGranted
+		}
+		var entries []*QuotaLedger
+		if unused > 0 {
+			entries = append(entries, newLedgerEntry(ctx, LedgerAccountUser, user.Id, user.Id, -unused, LedgerReasonPlan))
+		}
+		entries = append(entries, newLedgerEntry(ctx, LedgerAccountUser, user.Id, user.Id, plan.Quota, LedgerReasonPlan))
+		return appendLedgerEntries(tx, LedgerAccountUser, user.Id, entries)
+	})
+	if err != nil {
+		return err
+	}
+	if unused > 0 {
+		RecordLog(ctx, user.Id, LogTypeManage, fmt.Sprintf("套餐 %s 本期未使用的额度 %s 已清零", plan.Name, common.LogQuota(unused)))
+	}
+	RecordTopupLog(ctx, user.Id, fmt.Sprintf("套餐 %s 发放额度 %s", plan.Name, common.LogQuota(plan.Quota)), int(plan.Quota))
+	return nil
+}
+
+// SubscribeUserPlan replaces the current subscription of the user, if any,
+// and makes the first grant right away.
+func SubscribeUserPlan(ctx context.Context, userId int, planId int) error {
+	plan, err := GetPlanById(planId)
+	if err != nil {
+		return err
+	}
+	if plan.Status != PlanStatusEnabled {
+		return errors.New("该套餐已停用")
+	}
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	if user.PlanId != 0 {
+		err = CancelUserPlan(ctx, userId)
+		if err != nil {
+			return err
+		}
+		user, err = GetUserById(userId, false)
+		if err != nil {
+			return err
+		}
+	}
+	now := helper.GetTimestamp()
+	var expiredTime int64
+	if plan.Duration > 0 {
+		expiredTime = now + int64(plan.Duration)*24*60*60
+	}
+	updates := map[string]interface{}{
+		"plan_id":              plan.Id,
+		"plan_expired_time":    expiredTime,
+		"plan_next_grant_time": now,
+		"plan_granted_quota":   0,
+		"plan_used_quota_mark": user.UsedQuota,
+		"plan_previous_group":  "",
+	}
+	if plan.Group != "" && plan.Group != user.Group {
+		updates["plan_previous_group"] = user.Group
+		updates["group"] = plan.Group
+	}
+	err = DB.Model(&User{}).Where("id = ?", userId).Updates(updates).Error
+	if err != nil {
+		return err
+	}
+	invalidateUserGroupCache(userId)
+	RecordLog(ctx, userId, LogTypeManage, fmt.Sprintf("订阅套餐 %s", plan.Name))
+	user.PlanId = plan.Id
+	user.PlanNextGrantTime = now
+	user.PlanGrantedQuota = 0
+	return grantPlanQuota(ctx, user, plan)
+}
+
+// CancelUserPlan ends the subscription and moves the user back to the group
+// they were in before subscribing.
+func CancelUserPlan(ctx context.Context, userId int) error {
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	if user.PlanId == 0 {
+		return errors.New("该用户未订阅套餐")
+	}
+	planName := fmt.Sprintf("#%d", user.PlanId)
+	plan, err := GetPlanById(user.PlanId)
+	if err == nil {
+		planName = plan.Name
+		forfeitUnusedPlanQuota(ctx, user, plan)
+	}
+	updates := map[string]interface{}{
+		"plan_id":              0,
+		"plan_expired_time":    0,
+		"plan_next_grant_time": 0,
+		"plan_granted_quota":   0,
+		"plan_used_quota_mark": 0,
+		"plan_previous_group":  "",
+	}
+	if user.PlanPreviousGroup != "" {
+		updates["group"] = user.PlanPreviousGroup
+	}
+	err = DB.Model(&User{}).Where("id = ?", userId).Updates(updates).Error
+	if err != nil {
+		return err
+	}
+	invalidateUserGroupCache(userId)
+	RecordLog(ctx, userId, LogTypeManage, fmt.Sprintf("套餐 %s 已结束", planName))
+	return nil
+}
+
+// GrantDuePlanQuota makes the grants that are due and ends expired subscriptions.
+// Disabled plans only stop accepting new subscribers.
+func GrantDuePlanQuota(ctx context.Context) (granted int, err error) {
+	now := helper.GetTimestamp()
+	var users []*User
+	err = DB.Omit("password", "access_token").
+		Where("plan_id != 0 and (plan_next_grant_time <= ? or (plan_expired_time != 0 and plan_expired_time <= ?))", now, now).
+		Find(&users).Error
+	if err != nil {
+		return 0, err
+	}
+	plans := make(map[int]*Plan)
+	for _, user := range users {
+		if user.PlanExpiredTime != 0 && user.PlanExpiredTime <= now {
+			err = CancelUserPlan(ctx, user.Id)
+			if err != nil {
+				logger.Error(ctx, fmt.Sprintf("failed to end plan of user %d: %s", user.Id, err.Error()))
+			}
+			continue
+		}
+		plan, ok := plans[user.PlanId]
+		if !ok {
+			plan, err = GetPlanById(user.PlanId)
+			if err != nil {
+				logger.Error(ctx, fmt.Sprintf("failed to get plan %d of user %d: %s", user.PlanId, user.Id, err.Error()))
+				continue
+			}
+			plans[user.PlanId] = plan
+		}
+		err = grantPlanQuota(ctx, user, plan)
+		if errors.Is(err, errPlanQuotaGranted) {
+			continue
+		}
+		if err != nil {
+			logger.Error(ctx, fmt.Sprintf("failed to grant plan quota to user %d: %s", user.Id, err.Error()))
+			continue
+		}
+		granted++
+	}
+	return granted, nil
+}
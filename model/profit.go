@@ -0,0 +1,255 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+const (
+	ProfitDimensionDay     = "day"
+	ProfitDimensionChannel = "channel"
+	ProfitDimensionModel   = "model"
+	ProfitDimensionGroup   = "group"
+)
+
+// UpstreamPrice is what the upstream of a channel charges for a model, in USD.
+// Input and Output are per million tokens, Request is per request, e.g.
+// {"gpt-4o": {"input": 2.5, "output": 10}, "dall-e-3": {"request": 0.04}}
+// The model "*" applies to models without a price of their own.
+type UpstreamPrice struct {
+	Input   float64 `json:"input"`
+	Output  float64 `json:"output"`
+	Request float64 `json:"request"`
+}
+
+func parseUpstreamPrices(jsonStr string) (map[string]UpstreamPrice, error) {
+	prices := make(map[string]UpstreamPrice)
+	if jsonStr == "" {
+		return prices, nil
+	}
+	err := json.Unmarshal([]byte(jsonStr), &prices)
+	if err != nil {
+		return nil, fmt.Errorf("上游价格格式错误：%s", err.Error())
+	}
+	for model, price := range prices {
+		if price.Input < 0 || price.Output < 0 || price.Request < 0 {
+			return nil, fmt.Errorf("模型 %s 的上游价格不能为负数", model)
+		}
+	}
+	return prices, nil
+}
+
+func ValidateUpstreamPrices(jsonStr string) error {
+	_, err := parseUpstreamPrices(jsonStr)
+	return err
+}
+
+func (channel *Channel) GetUpstreamPrices() (map[string]UpstreamPrice, error) {
+	if channel.UpstreamPrices == nil {
+		return map[string]UpstreamPrice{}, nil
+	}
+	return parseUpstreamPrices(*channel.UpstreamPrices)
+}
+
+func getUpstreamPrice(prices map[string]UpstreamPrice, modelName string) (UpstreamPrice, bool) {
+	if price, ok := prices[modelName]; ok {
+		return price, true
+	}
+	price, ok := prices["*"]
+	return price, ok
+}
+
+// ProfitReportItem compares what users were charged (Revenue) with what the
+// upstream is estimated to have charged (Cost), both in USD. Requests to
+// models without an upstream price are counted in UnpricedRequestCount and
+// left out of Cost, Margin and MarginRate.
+type ProfitReportItem struct {
+	Day                  string  `json:"day,omitempty"`
+	ChannelId            int     `json:"channel_id,omitempty"`
+	ChannelName          string  `json:"channel_name,omitempty"`
+	ModelName            string  `json:"model_name,omitempty"`
+	Group                string  `json:"group,omitempty"`
+	RequestCount         int     `json:"request_count"`
+	UnpricedRequestCount int     `json:"unpriced_request_count"`
+	PromptTokens         int64   `json:"prompt_tokens"`
+	CompletionTokens     int64   `json:"completion_tokens"`
+	Quota                int64   `json:"quota"`
+	Revenue              float64 `json:"revenue"`
+	Cost                 float64 `json:"cost"`
+	Margin               float64 `json:"margin"`      // revenue of priced requests minus cost
+	MarginRate           float64 `json:"margin_rate"` // margin / revenue of priced requests
+	pricedRevenue        float64
+}
+
+func (item *ProfitReportItem) add(other *ProfitReportItem) {
+	item.RequestCount += other.RequestCount
+	item.UnpricedRequestCount += other.UnpricedRequestCount
+	item.PromptTokens += other.PromptTokens
+	item.CompletionTokens += other.CompletionTokens
+	item.Quota += other.Quota
+	item.Revenue += other.Revenue
+	item.Cost += other.Cost
+	item.pricedRevenue += other.pricedRevenue
+}
+
+func (item *ProfitReportItem) finish() {
+	item.Margin = item.pricedRevenue - item.Cost
+	if item.pricedRevenue != 0 {
+		item.MarginRate = item.Margin / item.pricedRevenue
+	}
+}
+
+type profitLogSum struct {
+	Day              string
+	ChannelId        int
+	ModelName        string
+	UserId           int
+	RequestCount     int
+	Quota            int64
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+func IsValidProfitDimension(dimension string) bool {
+	switch dimension {
+	case ProfitDimensionDay, ProfitDimensionChannel, ProfitDimensionModel, ProfitDimensionGroup:
+		return true
+	}
+	return false
+}
+
+// GetProfitReport aggregates the consume logs between the timestamps by the
+// given dimensions, and a total over all of them. Costs are estimated with the
+// current upstream prices of the channels, users are counted in their current group.
+func GetProfitReport(startTimestamp int64, endTimestamp int64, dimensions []string) (items []*ProfitReportItem, total *ProfitReportItem, err error) {
+	by := make(map[string]bool)
+	for _, dimension := range dimensions {
+		by[dimension] = true
+	}
+	// costs depend on the channel and the model, so logs are always grouped by them
+	selects := []string{"channel_id", "model_name", "count(*) as request_count", "sum(quota) as quota",
+		"sum(prompt_tokens) as prompt_tokens", "sum(completion_tokens) as completion_tokens"}
+	groups := []string{"channel_id", "model_name"}
+	if by[ProfitDimensionDay] {
+		selects = append(selects, logDaySelect())
+		groups = append(groups, "day")
+	}
+	if by[ProfitDimensionGroup] {
+		selects = append(selects, "user_id")
+		groups = append(groups, "user_id")
+	}
+	var sums []*profitLogSum
+	err = LOG_DB.Model(&Log{}).Select(strings.Join(selects, ", ")).
+		Where("type = ? and created_at >= ? and created_at < ?", LogTypeConsume, startTimestamp, endTimestamp).
+		Group(strings.Join(groups, ", ")).Scan(&sums).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	channelIds := make(map[int]bool)
+	userIds := make(map[int]bool)
+	for _, sum := range sums {
+		channelIds[sum.ChannelId] = true
+		userIds[sum.UserId] = true
+	}
+	// logs may live in another database, so channels and users are looked up separately
+	channels := make(map[int]*Channel)
+	for _, chunk := range chunkIds(mapKeys(channelIds)) {
+		var chunkChannels []*Channel
+		err = DB.Select("id", "name", "upstream_prices").Where("id in ?", chunk).Find(&chunkChannels).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, channel := range chunkChannels {
+			channels[channel.Id] = channel
+		}
+	}
+	userGroups := make(map[int]string)
+	if by[ProfitDimensionGroup] {
+		for _, chunk := range chunkIds(mapKeys(userIds)) {
+			var users []*User
+			err = DB.Select("id", "group").Where("id in ?", chunk).Find(&users).Error
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, user := range users {
+				userGroups[user.Id] = user.Group
+			}
+		}
+	}
+	channelPrices := make(map[int]map[string]UpstreamPrice)
+	for id, channel := range channels {
+		channelPrices[id], err = channel.GetUpstreamPrices()
+		if err != nil {
+			return nil, nil, fmt.Errorf("渠道 #%d %s", id, err.Error())
+		}
+	}
+
+	itemsByKey := make(map[string]*ProfitReportItem)
+	total = &ProfitReportItem{}
+	for _, sum := range sums {
+		row := &ProfitReportItem{
+			RequestCount:     sum.RequestCount,
+			PromptTokens:     sum.PromptTokens,
+			CompletionTokens: sum.CompletionTokens,
+			Quota:            sum.Quota,
+			Revenue:          float64(sum.Quota) / config.QuotaPerUnit,
+		}
+		if price, ok := getUpstreamPrice(channelPrices[sum.ChannelId], sum.ModelName); ok {
+			row.Cost = (float64(sum.PromptTokens)*price.Input+float64(sum.CompletionTokens)*price.Output)/1000000 +
+				float64(sum.RequestCount)*price.Request
+			row.pricedRevenue = row.Revenue
+		} else {
+			row.UnpricedRequestCount = sum.RequestCount
+		}
+		total.add(row)
+
+		key := &ProfitReportItem{}
+		if by[ProfitDimensionDay] {
+			key.Day = sum.Day
+		}
+		if by[ProfitDimensionChannel] {
+			key.ChannelId = sum.ChannelId
+			if channel, ok := channels[sum.ChannelId]; ok {
+				key.ChannelName = channel.Name
+			}
+		}
+		if by[ProfitDimensionModel] {
+			key.ModelName = sum.ModelName
+		}
+		if by[ProfitDimensionGroup] {
+			key.Group = userGroups[sum.UserId]
+		}
+		keyStr := fmt.Sprintf("%s|%d|%s|%s", key.Day, key.ChannelId, key.ModelName, key.Group)
+		item, ok := itemsByKey[keyStr]
+		if !ok {
+			item = key
+			itemsByKey[keyStr] = item
+			items = append(items, item)
+		}
+		item.add(row)
+	}
+	for _, item := range items {
+		item.finish()
+	}
+	total.finish()
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Day != items[j].Day {
+			return items[i].Day > items[j].Day
+		}
+		return items[i].Margin < items[j].Margin
+	})
+	return items, total, nil
+}
+
+func mapKeys(m map[int]bool) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// RateLimit limits the requests per minute, prompt tokens per minute and
+// requests per day of the relay. On tokens 0 means no limit, on users 0 falls
+// back to GroupRateLimits and -1 means no limit.
+type RateLimit struct {
+	RPM int `json:"rpm" gorm:"default:0"`
+	TPM int `json:"tpm" gorm:"default:0"`
+	RPD int `json:"rpd" gorm:"default:0"`
+}
+
+// IsValid reports whether the limits are -1, 0 or positive.
+func (l RateLimit) IsValid() bool {
+	return l.RPM >= -1 && l.TPM >= -1 && l.RPD >= -1
+}
+
+// WithDefault fills the limits that are 0 from d.
+func (l RateLimit) WithDefault(d RateLimit) RateLimit {
+	if l.RPM == 0 {
+		l.RPM = d.RPM
+	}
+	if l.TPM == 0 {
+		l.TPM = d.TPM
+	}
+	if l.RPD == 0 {
+		l.RPD = d.RPD
+	}
+	return l
+}
+
+var groupRateLimitsLock sync.RWMutex
+
+// GroupRateLimits are the default limits of the users in a group, e.g.
+// {"default": {"rpm": 60, "tpm": 100000, "rpd": 0}}
+var GroupRateLimits = map[string]RateLimit{}
+
+func GroupRateLimits2JSONString() string {
+	groupRateLimitsLock.RLock()
+	defer groupRateLimitsLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupRateLimits)
+	if err != nil {
+		logger.SysError("error marshalling group rate limits: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func parseGroupRateLimits(jsonStr string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	if jsonStr == "" {
+		return limits, nil
+	}
+	err := json.Unmarshal([]byte(jsonStr), &limits)
+	if err != nil {
+		return nil, fmt.Errorf("group rate limits must be an object of group to rpm, tpm and rpd: %s", err.Error())
+	}
+	for group, limit := range limits {
+		if limit.RPM < 0 || limit.TPM < 0 || limit.RPD < 0 {
+			return nil, fmt.Errorf("rate limits of group %s must not be negative", group)
+		}
+	}
+	return limits, nil
+}
+
+func ValidateGroupRateLimitsJSONString(jsonStr string) error {
+	_, err := parseGroupRateLimits(jsonStr)
+	return err
+}
+
+func UpdateGroupRateLimitsByJSONString(jsonStr string) error {
+	limits, err := parseGroupRateLimits(jsonStr)
+	if err != nil {
+		return err
+	}
+	groupRateLimitsLock.Lock()
+	defer groupRateLimitsLock.Unlock()
+	GroupRateLimits = limits
+	return nil
+}
+
+func GetGroupRateLimit(group string) RateLimit {
+	groupRateLimitsLock.RLock()
+	defer groupRateLimitsLock.RUnlock()
+	return GroupRateLimits[group]
+}
+
+type userRateLimit struct {
+	Group string `json:"group"`
+	RateLimit
+}
+
+func getUserRateLimit(id int) (*userRateLimit, error) {
+	var user User
+	err := DB.Model(&User{}).Select("group", "rpm", "tpm", "rpd").Where("id = ?", id).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &userRateLimit{Group: user.Group, RateLimit: user.RateLimit}, nil
+}
+
+// CacheGetUserRateLimit returns the limits of a user with the group defaults
+// applied, only the user's own limits are cached.
+func CacheGetUserRateLimit(id int) (RateLimit, error) {
+	key := fmt.Sprintf("user_rate_limit:%d", id)
+	var limit *userRateLimit
+	if common.RedisEnabled {
+		if jsonStr, err := common.RedisGet(key); err == nil {
+			limit = &userRateLimit{}
+			if err = json.Unmarshal([]byte(jsonStr), limit); err != nil {
+				limit = nil
+			}
+		}
+	}
+	if limit == nil {
+		var err error
+		limit, err = getUserRateLimit(id)
+		if err != nil {
+			return RateLimit{}, err
+		}
+		if common.RedisEnabled {
+			jsonBytes, _ := json.Marshal(limit)
+			err = common.RedisSet(key, string(jsonBytes), time.Duration(UserId2GroupCacheSeconds)*time.Second)
+			if err != nil {
+				logger.SysError("Redis set user rate limit error: " + err.Error())
+			}
+		}
+	}
+	return limit.RateLimit.WithDefault(GetGroupRateLimit(limit.Group)), nil
+}
+
+// UpdateUserRateLimit also saves zero limits, which User.Update skips.
+func UpdateUserRateLimit(id int, limit RateLimit) error {
+	return DB.Model(&User{Id: id}).Select("rpm", "tpm", "rpd").Updates(&User{RateLimit: limit}).Error
+}
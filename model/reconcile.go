@@ -0,0 +1,392 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// QuotaDiscrepancy describes an account whose recorded usage doesn't match
+// the usage derived from its consume logs.
+type QuotaDiscrepancy struct {
+	AccountType   int    `json:"account_type"`
+	AccountId     int    `json:"account_id"`
+	UserId        int    `json:"user_id"`
+	Name          string `json:"name"`
+	ExpectedQuota int64  `json:"expected_quota"` // from consume logs
+	RecordedQuota int64  `json:"recorded_quota"` // from used_quota or the ledger
+	Difference    int64  `json:"difference"`     // recorded - expected, positive means overcharged
+	Fixed         bool   `json:"fixed"`
+	Note          string `json:"note,omitempty"` // why it was not fixed
+}
+
+type QuotaReconcileReport struct {
+	StartTimestamp int64               `json:"start_timestamp"`
+	EndTimestamp   int64               `json:"end_timestamp"`
+	DryRun         bool                `json:"dry_run"`
+	CheckedUsers   int                 `json:"checked_users"`
+	CheckedTokens  int                 `json:"checked_tokens"`
+	Discrepancies  []*QuotaDiscrepancy `json:"discrepancies"`
+}
+
+type accountQuotaSum struct {
+	Id    int   `gorm:"column:id"`
+	Quota int64 `gorm:"column:quota"`
+}
+
+// sumConsumeLogQuota sums the consume logs by column. Logs written before the
+// upgrade that added token_id have it set to 0, they are skipped unless withoutTokenId,
+// because the quota ledger doesn't cover them either.
+func sumConsumeLogQuota(column string, startTimestamp int64, endTimestamp int64, withoutTokenId bool) (map[int]int64, error) {
+	var sums []accountQuotaSum
+	tx := LOG_DB.Table("logs").
+		Select(fmt.Sprintf("%s as id, sum(quota) as quota", column)).
+		Where(fmt.Sprintf("type = ? and %s != 0", column), LogTypeConsume)
+	if !withoutTokenId {
+		tx = tx.Where("token_id != 0")
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err := tx.Group(column).Scan(&sums).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]int64, len(sums))
+	for _, sum := range sums {
+		result[sum.Id] = sum.Quota
+	}
+	return result, nil
+}
+
+// reconcilePeriodKey is stored as the request id of the corrections made for
+// a period, so they are taken into account when the same period is checked again.
+func reconcilePeriodKey(startTimestamp int64, endTimestamp int64) string {
+	return fmt.Sprintf("reconcile-%d-%d", startTimestamp, endTimestamp)
+}
+
+// defaultReconcileRequestLifetime is used as the longest time a request takes
+// from pre-consuming quota to writing its consume log when RELAY_TIMEOUT is not set.
+const defaultReconcileRequestLifetime = 60 * 60
+
+// ReconcileRequestLifetime returns the longest time in seconds a request takes
+// from pre-consuming quota to writing its consume log.
+func ReconcileRequestLifetime() int64 {
+	if config.RelayTimeout > 0 {
+		return int64(config.RelayTimeout) + 60
+	}
+	return defaultReconcileRequestLifetime
+}
+
+var reconcileLedgerReasons = []string{LedgerReasonPreConsume, LedgerReasonConsume, LedgerReasonRefund}
+
+func sumLedgerConsumption(accountType int, startTimestamp int64, endTimestamp int64) (map[int]int64, error) {
+	var sums []accountQuotaSum
+	err := DB.Model(&QuotaLedger{}).
+		Select("account_id as id, -sum(delta) as quota").
+		Where("account_type = ?", accountType).
+		Where(DB.Where("reason in ? and created_at >= ? and created_at <= ?", reconcileLedgerReasons, startTimestamp, endTimestamp).
+			Or("reason = ? and request_id = ?", LedgerReasonReconcile, reconcilePeriodKey(startTimestamp, endTimestamp))).
+		Group("account_id").Scan(&sums).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]int64, len(sums))
+	for _, sum := range sums {
+		result[sum.Id] = sum.Quota
+	}
+	err = moveStraddlingRequests(result, accountType, startTimestamp, endTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// moveStraddlingRequests counts the ledger entries of a request in the period
+// of its consume log. The quota is pre-consumed when a request starts and the
+// log is written when it ends, so a request can start before a boundary of the
+// period and end after it. Only the entries near the boundaries are checked.
+func moveStraddlingRequests(sums map[int]int64, accountType int, startTimestamp int64, endTimestamp int64) error {
+	lifetime := ReconcileRequestLifetime()
+	var entries []*QuotaLedger
+	err := DB.Select("account_id", "delta", "request_id", "created_at").
+		Where("account_type = ? and reason in ? and request_id != ''", accountType, reconcileLedgerReasons).
+		Where(DB.Where("created_at >= ? and created_at <= ?", startTimestamp-lifetime, startTimestamp+lifetime).
+			Or("created_at >= ? and created_at <= ?", endTimestamp-lifetime, endTimestamp+lifetime)).
+		Find(&entries).Error
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	requestIds := make([]string, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !seen[entry.RequestId] {
+			seen[entry.RequestId] = true
+			requestIds = append(requestIds, entry.RequestId)
+		}
+	}
+	logTimes, err := getConsumeLogTimes(requestIds)
+	if err != nil {
+		return err
+	}
+	inPeriod := func(timestamp int64) bool {
+		return timestamp >= startTimestamp && timestamp <= endTimestamp
+	}
+	for _, entry := range entries {
+		logTime, ok := logTimes[entry.RequestId]
+		if !ok {
+			// failed requests have no log, their refund is near the pre-consumption
+			continue
+		}
+		if inPeriod(entry.CreatedAt) && !inPeriod(logTime) {
+			sums[entry.AccountId] += entry.Delta
+		} else if !inPeriod(entry.CreatedAt) && inPeriod(logTime) {
+			sums[entry.AccountId] -= entry.Delta
+		}
+	}
+	return nil
+}
+
+type consumeLogTime struct {
+	RequestId string `gorm:"column:request_id"`
+	CreatedAt int64  `gorm:"column:created_at"`
+}
+
+// getConsumeLogTimes returns when the consume logs of the requests were written.
+func getConsumeLogTimes(requestIds []string) (map[string]int64, error) {
+	result := make(map[string]int64, len(requestIds))
+	for i := 0; i < len(requestIds); i += 500 {
+		end := i + 500
+		if end > len(requestIds) {
+			end = len(requestIds)
+		}
+		var times []consumeLogTime
+		err := LOG_DB.Table("logs").
+			Select("request_id, max(created_at) as created_at").
+			Where("type = ? and request_id in ?", LogTypeConsume, requestIds[i:end]).
+			Group("request_id").Scan(&times).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range times {
+			result[t.RequestId] = t.CreatedAt
+		}
+	}
+	return result, nil
+}
+
+// addChildTokenQuota adds the usage of child tokens to their parents, whose
+// used_quota includes it, see UpdateTokenUsedQuota.
+func addChildTokenQuota(expectedTokens map[int]int64) error {
+	var children []*Token
+	err := DB.Select("id", "parent_id").Where("parent_id != 0").Find(&children).Error
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		expectedTokens[child.ParentId] += expectedTokens[child.Id]
+	}
+	return nil
+}
+
+// earliestLogTimestamp returns when the oldest remaining log was written,
+// older logs may have been deleted, see DeleteOldLog.
+func earliestLogTimestamp() (timestamp int64, err error) {
+	err = LOG_DB.Model(&Log{}).Select("COALESCE(min(created_at),0)").Scan(&timestamp).Error
+	return timestamp, err
+}
+
+// ReconcileQuota recomputes the used quota of every user and token from the
+// consume logs in [startTimestamp, endTimestamp].
+// Without a start timestamp the whole history is checked against the used_quota
+// counters, otherwise the period is checked against the quota ledger, because
+// the counters also include usage from before the period.
+// Differences within tolerance are ignored, they are usually requests still
+// being billed. When dryRun is false, the differences are corrected, which is
+// only allowed for a period: the whole history includes usage from before the
+// upgrade that can't be attributed to tokens, and logs that were deleted.
+func ReconcileQuota(ctx context.Context, startTimestamp int64, endTimestamp int64, tolerance int64, dryRun bool) (*QuotaReconcileReport, error) {
+	if !config.LogConsumeEnabled {
+		return nil, errors.New("未启用消费日志，无法进行额度核对")
+	}
+	if startTimestamp == 0 && !dryRun {
+		return nil, errors.New("核对全部历史时只能报告差异，修正差异需要指定 start_timestamp")
+	}
+	if startTimestamp != 0 && endTimestamp == 0 {
+		endTimestamp = helper.GetTimestamp()
+	}
+	// requests started in the last moments of the period may not be logged yet,
+	// their pre-consumed quota would be given back
+	if !dryRun && endTimestamp > helper.GetTimestamp()-ReconcileRequestLifetime() {
+		endTimestamp = helper.GetTimestamp() - ReconcileRequestLifetime()
+		if endTimestamp < startTimestamp {
+			return nil, errors.New("该时段内可能仍有未结束的请求，请稍后再修正差异")
+		}
+	}
+	report := &QuotaReconcileReport{
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		DryRun:         dryRun,
+		Discrepancies:  make([]*QuotaDiscrepancy, 0),
+	}
+	// used_quota of users includes the usage from before token_id was logged
+	expectedUsers, err := sumConsumeLogQuota("user_id", startTimestamp, endTimestamp, startTimestamp == 0)
+	if err != nil {
+		return nil, err
+	}
+	expectedTokens, err := sumConsumeLogQuota("token_id", startTimestamp, endTimestamp, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*User
+	var tokens []*Token
+	recordedUsers := make(map[int]int64)
+	recordedTokens := make(map[int]int64)
+	if startTimestamp == 0 {
+		err = DB.Select("id", "username", "used_quota").Where("status != ?", UserStatusDeleted).Find(&users).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			recordedUsers[user.Id] = user.UsedQuota
+		}
+		err = DB.Select("id", "user_id", "name", "used_quota").Where("unlimited_quota = ?", false).Find(&tokens).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, token := range tokens {
+			recordedTokens[token.Id] = token.UsedQuota
+		}
+		if err = addChildTokenQuota(expectedTokens); err != nil {
+			return nil, err
+		}
+	} else {
+		recordedUsers, err = sumLedgerConsumption(LedgerAccountUser, startTimestamp, endTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		recordedTokens, err = sumLedgerConsumption(LedgerAccountToken, startTimestamp, endTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		err = DB.Select("id", "username").Where("status != ?", UserStatusDeleted).Find(&users).Error
+		if err != nil {
+			return nil, err
+		}
+		err = DB.Select("id", "user_id", "name").Where("unlimited_quota = ?", false).Find(&tokens).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, user := range users {
+		expected, recorded := expectedUsers[user.Id], recordedUsers[user.Id]
+		if expected == 0 && recorded == 0 {
+			continue
+		}
+		report.CheckedUsers++
+		if abs(recorded-expected) <= tolerance {
+			continue
+		}
+		report.Discrepancies = append(report.Discrepancies, &QuotaDiscrepancy{
+			AccountType:   LedgerAccountUser,
+			AccountId:     user.Id,
+			UserId:        user.Id,
+			Name:          user.Username,
+			ExpectedQuota: expected,
+			RecordedQuota: recorded,
+			Difference:    recorded - expected,
+		})
+	}
+	for _, token := range tokens {
+		expected, recorded := expectedTokens[token.Id], recordedTokens[token.Id]
+		if expected == 0 && recorded == 0 {
+			continue
+		}
+		report.CheckedTokens++
+		if abs(recorded-expected) <= tolerance {
+			continue
+		}
+		report.Discrepancies = append(report.Discrepancies, &QuotaDiscrepancy{
+			AccountType:   LedgerAccountToken,
+			AccountId:     token.Id,
+			UserId:        token.UserId,
+			Name:          token.Name,
+			ExpectedQuota: expected,
+			RecordedQuota: recorded,
+			Difference:    recorded - expected,
+		})
+	}
+	if dryRun {
+		return report, nil
+	}
+	// logs of the period may have been deleted, then the usage they recorded
+	// would be given back for free
+	earliest, err := earliestLogTimestamp()
+	if err != nil {
+		return nil, err
+	}
+	mayBeDeleted := startTimestamp < earliest
+	ctx = helper.SetRequestID(ctx, reconcilePeriodKey(startTimestamp, endTimestamp))
+	for _, discrepancy := range report.Discrepancies {
+		if discrepancy.Difference > 0 && mayBeDeleted {
+			discrepancy.Note = "该时段的日志可能已被清理，不退还额度"
+			continue
+		}
+		err := fixQuotaDiscrepancy(ctx, discrepancy)
+		if err != nil {
+			logger.Error(ctx, fmt.Sprintf("failed to fix quota discrepancy of account %d#%d: %s", discrepancy.AccountType, discrepancy.AccountId, err.Error()))
+			continue
+		}
+		discrepancy.Fixed = true
+	}
+	return report, nil
+}
+
+// fixQuotaDiscrepancy gives back what was overcharged, or charges what was
+// missed, so that the recorded usage matches the consume logs again.
+func fixQuotaDiscrepancy(ctx context.Context, discrepancy *QuotaDiscrepancy) (err error) {
+	diff := discrepancy.Difference
+	switch discrepancy.AccountType {
+	case LedgerAccountUser:
+		if diff > 0 {
+			err = IncreaseUserQuota(ctx, discrepancy.AccountId, diff, LedgerReasonReconcile)
+		} else {
+			err = DecreaseUserQuota(ctx, discrepancy.AccountId, -diff, LedgerReasonReconcile)
+		}
+		if err != nil {
+			return err
+		}
+		updateUserUsedQuota(discrepancy.AccountId, -diff)
+		RecordLog(ctx, discrepancy.UserId, LogTypeManage, fmt.Sprintf("额度核对：已用额度与消费日志相差 %s，已自动修正", common.LogQuota(diff)))
+	case LedgerAccountToken:
+		token := &Token{Id: discrepancy.AccountId, UserId: discrepancy.UserId}
+		// both also move used_quota in the opposite direction
+		if diff > 0 {
+			err = IncreaseTokenQuota(ctx, token, diff, LedgerReasonReconcile)
+		} else {
+			err = DecreaseTokenQuota(ctx, token, -diff, LedgerReasonReconcile)
+		}
+		if err != nil {
+			return err
+		}
+		RecordLog(ctx, discrepancy.UserId, LogTypeManage, fmt.Sprintf("额度核对：令牌 %s 已用额度与消费日志相差 %s，已自动修正", discrepancy.Name, common.LogQuota(diff)))
+	}
+	return nil
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
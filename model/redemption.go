@@ -9,6 +9,7 @@ import (
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
 )
 
 const (
@@ -25,8 +26,28 @@ type Redemption struct {
 	Name         string `json:"name" gorm:"index"`
 	Quota        int64  `json:"quota" gorm:"bigint;default:100"`
 	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
-	RedeemedTime int64  `json:"redeemed_time" gorm:"bigint"`
-	Count        int    `json:"count" gorm:"-:all"` // only for api request
+	RedeemedTime int64  `json:"redeemed_time" gorm:"bigint"` // of the latest redemption
+	Campaign     string `json:"campaign" gorm:"type:varchar(64);default:'';index"`
+	ExpiredTime  int64  `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	MaxUses      int    `json:"max_uses" gorm:"default:1"`
+	UsedCount    int    `json:"used_count" gorm:"default:0"`
+	PerUserLimit int    `json:"per_user_limit" gorm:"default:1"`          // 0 means no limit
+	Group        string `json:"group" gorm:"type:varchar(32);default:''"` // redeemers are moved to this group
+	PlanId       int    `json:"plan_id" gorm:"default:0"`                 // redeemers are subscribed to this plan
+	Count        int    `json:"count" gorm:"-:all"`                       // only for api request
+}
+
+// RedemptionRecord is one use of a redemption code. Seq numbers the uses of
+// the same code by the same user, its unique index keeps concurrent
+// redemptions from exceeding the per-user limit.
+type RedemptionRecord struct {
+	Id           int    `json:"id"`
+	RedemptionId int    `json:"redemption_id" gorm:"uniqueIndex:idx_redemption_user_seq,priority:1"`
+	UserId       int    `json:"user_id" gorm:"uniqueIndex:idx_redemption_user_seq,priority:2;index"`
+	Seq          int    `json:"seq" gorm:"uniqueIndex:idx_redemption_user_seq,priority:3"`
+	Campaign     string `json:"campaign" gorm:"type:varchar(64);default:'';index"`
+	Quota        int64  `json:"quota" gorm:"bigint"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint"`
 }
 
 func GetAllRedemptions(startIdx int, num int) ([]*Redemption, error) {
@@ -66,26 +87,87 @@ func Redeem(ctx context.Context, key string, userId int) (quota int64, err error
 	}
 
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
+		err := tx.Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("无效的兑换码")
 		}
-		if redemption.Status != RedemptionCodeStatusEnabled {
+		switch redemption.Status {
+		case RedemptionCodeStatusEnabled:
+		case RedemptionCodeStatusDisabled:
+			return errors.New("该兑换码已被禁用")
+		default:
+			return errors.New("该兑换码已被使用")
+		}
+		now := helper.GetTimestamp()
+		if redemption.ExpiredTime != -1 && redemption.ExpiredTime < now {
+			return errors.New("该兑换码已过期")
+		}
+		var userUses int64
+		err = tx.Model(&RedemptionRecord{}).Where("redemption_id = ? and user_id = ?", redemption.Id, userId).Count(&userUses).Error
+		if err != nil {
+			return err
+		}
+		if redemption.PerUserLimit > 0 && userUses >= int64(redemption.PerUserLimit) {
+			return errors.New("您已达到该兑换码的使用次数上限")
+		}
+		// the condition makes concurrent redemptions take the remaining uses one by one
+		result := tx.Model(&Redemption{}).
+			Where("id = ? and status = ? and used_count < max_uses", redemption.Id, RedemptionCodeStatusEnabled).
+			Updates(map[string]interface{}{
+				"used_count":    gorm.Expr("used_count + 1"),
+				"redeemed_time": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
 			return errors.New("该兑换码已被使用")
 		}
+		err = tx.Model(&Redemption{}).Where("id = ? and used_count >= max_uses", redemption.Id).Update("status", RedemptionCodeStatusUsed).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Create(&RedemptionRecord{
+			RedemptionId: redemption.Id,
+			UserId:       userId,
+			Seq:          int(userUses) + 1,
+			Campaign:     redemption.Campaign,
+			Quota:        redemption.Quota,
+			CreatedAt:    now,
+		}).Error
+		if err != nil {
+			return errors.New("请勿重复兑换")
+		}
 		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
 		if err != nil {
 			return err
 		}
-		redemption.RedeemedTime = helper.GetTimestamp()
-		redemption.Status = RedemptionCodeStatusUsed
-		err = tx.Save(redemption).Error
+		entry := newLedgerEntry(ctx, LedgerAccountUser, userId, userId, redemption.Quota, LedgerReasonRedeem)
+		entry.Remark = fmt.Sprintf("redemption #%d", redemption.Id)
+		err = appendLedgerEntries(tx, LedgerAccountUser, userId, []*QuotaLedger{entry})
+		if err != nil {
+			return err
+		}
+		if redemption.Group != "" {
+			err = tx.Model(&User{}).Where("id = ?", userId).Update("group", redemption.Group).Error
+		}
 		return err
 	})
 	if err != nil {
 		return 0, errors.New("兑换失败，" + err.Error())
 	}
-	RecordLog(ctx, userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s", common.LogQuota(redemption.Quota)))
+	RecordTopupLog(ctx, userId, fmt.Sprintf("通过兑换码充值 %s", common.LogQuota(redemption.Quota)), int(redemption.Quota))
+	if redemption.Group != "" {
+		invalidateUserGroupCache(userId)
+		RecordLog(ctx, userId, LogTypeManage, fmt.Sprintf("通过兑换码加入分组 %s", redemption.Group))
+	}
+	if redemption.PlanId != 0 {
+		// the quota has been credited already, a failed subscription doesn't undo it
+		err = SubscribeUserPlan(ctx, userId, redemption.PlanId)
+		if err != nil {
+			logger.Error(ctx, fmt.Sprintf("failed to subscribe user %d to plan %d by redemption #%d: %s", userId, redemption.PlanId, redemption.Id, err.Error()))
+		}
+	}
 	return redemption.Quota, nil
 }
 
@@ -100,13 +182,98 @@ func (redemption *Redemption) SelectUpdate() error {
 	return DB.Model(redemption).Select("redeemed_time", "status").Updates(redemption).Error
 }
 
+// migrateRedemptionUsedCount fills used_count of the codes used up before
+// codes could be used more than once, their used_count column defaults to 0.
+func migrateRedemptionUsedCount() error {
+	result := DB.Model(&Redemption{}).Where("status = ? and used_count < max_uses", RedemptionCodeStatusUsed).
+		Update("used_count", gorm.Expr("max_uses"))
+	if result.RowsAffected > 0 {
+		logger.SysLog(fmt.Sprintf("filled the used count of %d used redemption codes", result.RowsAffected))
+	}
+	return result.Error
+}
+
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (redemption *Redemption) Update() error {
 	var err error
-	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time").Updates(redemption).Error
+	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time",
+		"campaign", "expired_time", "max_uses", "per_user_limit", "group", "plan_id").Updates(redemption).Error
 	return err
 }
 
+// BatchInsertRedemptions is used for bulk generation, which can be thousands of codes.
+func BatchInsertRedemptions(redemptions []*Redemption) error {
+	return DB.CreateInBatches(redemptions, 500).Error
+}
+
+// RedemptionCampaignReport summarizes the codes of a campaign and their uses.
+type RedemptionCampaignReport struct {
+	Campaign          string `json:"campaign"`
+	Codes             int64  `json:"codes"`
+	EnabledCodes      int64  `json:"enabled_codes"`
+	UsedUpCodes       int64  `json:"used_up_codes"`
+	ExpiredCodes      int64  `json:"expired_codes"`
+	TotalUses         int64  `json:"total_uses"` // the sum of max_uses
+	Redemptions       int64  `json:"redemptions"`
+	Users             int64  `json:"users"`
+	RedeemedQuota     int64  `json:"redeemed_quota"`
+	FirstRedeemedTime int64  `json:"first_redeemed_time"`
+	LastRedeemedTime  int64  `json:"last_redeemed_time"`
+}
+
+type redemptionRecordStat struct {
+	Campaign          string
+	Redemptions       int64
+	Users             int64
+	RedeemedQuota     int64
+	FirstRedeemedTime int64
+	LastRedeemedTime  int64
+}
+
+// GetRedemptionCampaignReports reports every campaign, or only the given one.
+func GetRedemptionCampaignReports(campaign string) ([]*RedemptionCampaignReport, error) {
+	now := helper.GetTimestamp()
+	var reports []*RedemptionCampaignReport
+	tx := DB.Model(&Redemption{}).Select(`campaign, count(*) as codes,
+		sum(case when status = ? then 1 else 0 end) as enabled_codes,
+		sum(case when status = ? then 1 else 0 end) as used_up_codes,
+		sum(case when expired_time != -1 and expired_time < ? then 1 else 0 end) as expired_codes,
+		sum(max_uses) as total_uses`, RedemptionCodeStatusEnabled, RedemptionCodeStatusUsed, now)
+	if campaign != "" {
+		tx = tx.Where("campaign = ?", campaign)
+	}
+	err := tx.Group("campaign").Order("campaign").Scan(&reports).Error
+	if err != nil {
+		return nil, err
+	}
+	var stats []*redemptionRecordStat
+	tx = DB.Model(&RedemptionRecord{}).Select(`campaign, count(*) as redemptions, count(distinct user_id) as users,
+		sum(quota) as redeemed_quota, min(created_at) as first_redeemed_time, max(created_at) as last_redeemed_time`)
+	if campaign != "" {
+		tx = tx.Where("campaign = ?", campaign)
+	}
+	err = tx.Group("campaign").Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	statMap := make(map[string]*redemptionRecordStat, len(stats))
+	for _, stat := range stats {
+		statMap[stat.Campaign] = stat
+	}
+	for _, report := range reports {
+		stat, ok := statMap[report.Campaign]
+		if !ok {
+			continue
+		}
+		report.Redemptions = stat.Redemptions
+		report.Users = stat.Users
+		report.RedeemedQuota = stat.RedeemedQuota
+		report.FirstRedeemedTime = stat.FirstRedeemedTime
+		report.LastRedeemedTime = stat.LastRedeemedTime
+	}
+	return reports, nil
+}
+
 func (redemption *Redemption) Delete() error {
 	var err error
 	err = DB.Delete(redemption).Error
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+// ReferralSettlement is one run of the referral commission settlement,
+// settlements cover consecutive periods of consume logs.
+type ReferralSettlement struct {
+	Id             int   `json:"id"`
+	StartTimestamp int64 `json:"start_timestamp" gorm:"bigint"`
+	EndTimestamp   int64 `json:"end_timestamp" gorm:"bigint;index"`
+	Invitees       int   `json:"invitees"`
+	Commission     int64 `json:"commission" gorm:"bigint"`
+	CreatedAt      int64 `json:"created_at" gorm:"bigint"`
+}
+
+// ReferralCommission is what an inviter earned from one invitee in one settlement.
+type ReferralCommission struct {
+	Id            int   `json:"id"`
+	SettlementId  int   `json:"settlement_id" gorm:"index"`
+	InviterId     int   `json:"inviter_id" gorm:"index"`
+	InviteeId     int   `json:"invitee_id" gorm:"index"`
+	ConsumedQuota int64 `json:"consumed_quota" gorm:"bigint"`
+	Commission    int64 `json:"commission" gorm:"bigint"`
+	CreatedAt     int64 `json:"created_at" gorm:"bigint"`
+}
+
+type ReferralStat struct {
+	AffCode           string  `json:"aff_code"`
+	ReferralCount     int64   `json:"referral_count"`
+	EarnedCommission  int64   `json:"earned_commission"`
+	PendingCommission int64   `json:"pending_commission"`
+	CommissionRate    float64 `json:"commission_rate"` // 0 when commission is disabled
+}
+
+var referralSettleLock sync.Mutex
+
+// referralIdChunk keeps IN lists within the limits of every database
+const referralIdChunk = 1000
+
+func chunkIds(ids []int) [][]int {
+	var chunks [][]int
+	for len(ids) > referralIdChunk {
+		chunks = append(chunks, ids[:referralIdChunk])
+		ids = ids[referralIdChunk:]
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+	return chunks
+}
+
+// SettleReferralCommission credits each inviter with a share of what their
+// invitees consumed since the previous settlement, up to endTimestamp.
+// firstStartTimestamp is only used when nothing has been settled yet.
+// The commission goes to aff_quota and can be transferred to quota by the inviter.
+func SettleReferralCommission(ctx context.Context, firstStartTimestamp int64, endTimestamp int64) (*ReferralSettlement, error) {
+	referralSettleLock.Lock()
+	defer referralSettleLock.Unlock()
+	if !config.ReferralCommissionEnabled || config.ReferralCommissionRate <= 0 {
+		return nil, errors.New("未启用邀请返佣")
+	}
+	if !config.LogConsumeEnabled {
+		return nil, errors.New("未启用消费日志，无法结算邀请返佣")
+	}
+	startTimestamp := firstStartTimestamp
+	var last ReferralSettlement
+	err := DB.Order("end_timestamp desc").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, err
+	}
+	if last.Id != 0 {
+		startTimestamp = last.EndTimestamp + 1
+	}
+	if startTimestamp > endTimestamp {
+		return nil, errors.New("没有需要结算的时间段")
+	}
+	consumed, err := sumConsumeLogQuota("user_id", startTimestamp, endTimestamp, true)
+	if err != nil {
+		return nil, err
+	}
+	userIds := make([]int, 0, len(consumed))
+	for userId := range consumed {
+		userIds = append(userIds, userId)
+	}
+	var invitees []*User
+	earned := make(map[int]int64)
+	for _, chunk := range chunkIds(userIds) {
+		var users []*User
+		err = DB.Select("id", "inviter_id", "used_quota").Where("inviter_id != 0 and id in ?", chunk).Find(&users).Error
+		if err != nil {
+			return nil, err
+		}
+		invitees = append(invitees, users...)
+		if config.ReferralCommissionCapPerInvitee <= 0 {
+			continue
+		}
+		var sums []accountQuotaSum
+		err = DB.Model(&ReferralCommission{}).Select("invitee_id as id, sum(commission) as quota").
+			Where("invitee_id in ?", chunk).Group("invitee_id").Scan(&sums).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, sum := range sums {
+			earned[sum.Id] = sum.Quota
+		}
+	}
+
+	settlement := &ReferralSettlement{
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		CreatedAt:      helper.GetTimestamp(),
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(settlement).Error
+		if err != nil {
+			return err
+		}
+		for _, invitee := range invitees {
+			if invitee.UsedQuota < config.ReferralCommissionMinSpend {
+				continue
+			}
+			commission := int64(float64(consumed[invitee.Id]) * config.ReferralCommissionRate / 100)
+			if config.ReferralCommissionCapPerInvitee > 0 && earned[invitee.Id]+commission > config.ReferralCommissionCapPerInvitee {
+				commission = config.ReferralCommissionCapPerInvitee - earned[invitee.Id]
+			}
+			if commission <= 0 {
+				continue
+			}
+			// inviters that are disabled or deleted don't earn anything
+			result := tx.Model(&User{}).Where("id = ? and status = ?", invitee.InviterId, UserStatusEnabled).Updates(map[string]interface{}{
+				"aff_quota":         gorm.Expr("aff_quota + ?", commission),
+				"aff_history_quota": gorm.Expr("aff_history_quota + ?", commission),
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			err = tx.Create(&ReferralCommission{
+				SettlementId:  settlement.Id,
+				InviterId:     invitee.InviterId,
+				InviteeId:     invitee.Id,
+				ConsumedQuota: consumed[invitee.Id],
+				Commission:    commission,
+				CreatedAt:     settlement.CreatedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+			settlement.Invitees++
+			settlement.Commission += commission
+		}
+		return tx.Model(settlement).Select("invitees", "commission").Updates(settlement).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return settlement, nil
+}
+
+func GetReferralStat(userId int) (*ReferralStat, error) {
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	stat := &ReferralStat{
+		AffCode:           user.AffCode,
+		EarnedCommission:  user.AffHistoryQuota,
+		PendingCommission: user.AffQuota,
+	}
+	if config.ReferralCommissionEnabled {
+		stat.CommissionRate = config.ReferralCommissionRate
+	}
+	err = DB.Model(&User{}).Where("inviter_id = ?", userId).Count(&stat.ReferralCount).Error
+	return stat, err
+}
+
+func GetUserReferralCommissions(userId int, startIdx int, num int) (commissions []*ReferralCommission, err error) {
+	err = DB.Where("inviter_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&commissions).Error
+	return commissions, err
+}
+
+// TransferAffQuota moves earned referral commission into the quota of the user.
+func TransferAffQuota(ctx context.Context, userId int, quota int64) error {
+	if quota <= 0 {
+		return errors.New("划转额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? and aff_quota >= ?", userId, quota).Updates(map[string]interface{}{
+			"aff_quota": gorm.Expr("aff_quota - ?", quota),
+			"quota":     gorm.Expr("quota + ?", quota),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("邀请返佣余额不足")
+		}
+		entry := newLedgerEntry(ctx, LedgerAccountUser, userId, userId, quota, LedgerReasonReferral)
+		return appendLedgerEntries(tx, LedgerAccountUser, userId, []*QuotaLedger{entry})
+	})
+	if err != nil {
+		return err
+	}
+	RecordTopupLog(ctx, userId, fmt.Sprintf("邀请返佣划转 %s", common.LogQuota(quota)), int(quota))
+	return nil
+}
@@ -1,8 +1,12 @@
 package model
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -13,6 +17,34 @@ import (
 	"github.com/songquanpeng/one-api/common/message"
 )
 
+const (
+	TokenBudgetPeriodNone  = ""
+	TokenBudgetPeriodDay   = "day"
+	TokenBudgetPeriodWeek  = "week"
+	TokenBudgetPeriodMonth = "month"
+)
+
+// token scopes limit the APIs a token may call, a token without scopes may call all of them
+const (
+	TokenScopeChat        = "chat"
+	TokenScopeCompletions = "completions"
+	TokenScopeEmbeddings  = "embeddings"
+	TokenScopeImages      = "images"
+	TokenScopeAudio       = "audio"
+	TokenScopeModerations = "moderations"
+	TokenScopeProxy       = "proxy"
+	TokenScopeBillingRead = "billing-read"
+	TokenScopeTokens      = "tokens" // mint child tokens, only granted explicitly
+)
+
+var TokenScopes = []string{TokenScopeChat, TokenScopeCompletions, TokenScopeEmbeddings, TokenScopeImages,
+	TokenScopeAudio, TokenScopeModerations, TokenScopeProxy, TokenScopeBillingRead, TokenScopeTokens}
+
+const (
+	TokenSystemPromptModeReplace = "replace" // replace the system prompt of the request, or add one
+	TokenSystemPromptModePrepend = "prepend" // add a system message before the messages of the request
+)
+
 const (
 	TokenStatusEnabled   = 1 // don't use 0, 0 is the default value!
 	TokenStatusDisabled  = 2 // also don't use 0
@@ -21,19 +53,280 @@ const (
 )
 
 type Token struct {
-	Id             int     `json:"id"`
-	UserId         int     `json:"user_id"`
-	Key            string  `json:"key" gorm:"type:char(48);uniqueIndex"`
-	Status         int     `json:"status" gorm:"default:1"`
-	Name           string  `json:"name" gorm:"index" `
-	CreatedTime    int64   `json:"created_time" gorm:"bigint"`
-	AccessedTime   int64   `json:"accessed_time" gorm:"bigint"`
-	ExpiredTime    int64   `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
-	RemainQuota    int64   `json:"remain_quota" gorm:"bigint;default:0"`
-	UnlimitedQuota bool    `json:"unlimited_quota" gorm:"default:false"`
-	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
-	Models         *string `json:"models" gorm:"type:text"`            // allowed models
-	Subnet         *string `json:"subnet" gorm:"default:''"`           // allowed subnet
+	Id        int    `json:"id"`
+	UserId    int    `json:"user_id"`
+	Key       string `json:"key,omitempty" gorm:"-"`                        // only known when the token is created
+	KeyHash   string `json:"-" gorm:"column:key;type:char(64);uniqueIndex"` // see common.HashTokenKey
+	KeyPrefix string `json:"key_prefix" gorm:"type:varchar(8);default:''"`  // for display
+	// the previous key keeps working until PreviousKeyExpiredTime after a rotation
+	PreviousKeyHash        string  `json:"-" gorm:"type:char(64);index"`
+	PreviousKeyPrefix      string  `json:"previous_key_prefix" gorm:"type:varchar(8);default:''"`
+	PreviousKeyExpiredTime int64   `json:"previous_key_expired_time" gorm:"bigint;default:0"`
+	UsingPreviousKey       bool    `json:"using_previous_key,omitempty" gorm:"-"` // set by CacheGetTokenByKey
+	Status                 int     `json:"status" gorm:"default:1"`
+	Name                   string  `json:"name" gorm:"index" `
+	CreatedTime            int64   `json:"created_time" gorm:"bigint"`
+	AccessedTime           int64   `json:"accessed_time" gorm:"bigint"`
+	ExpiredTime            int64   `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	RemainQuota            int64   `json:"remain_quota" gorm:"bigint;default:0"`
+	UnlimitedQuota         bool    `json:"unlimited_quota" gorm:"default:false"`
+	UsedQuota              int64   `json:"used_quota" gorm:"bigint;default:0"`         // used quota
+	Models                 *string `json:"models" gorm:"type:text"`                    // allowed models
+	Subnet                 *string `json:"subnet" gorm:"default:''"`                   // allowed subnet
+	Scopes                 *string `json:"scopes" gorm:"type:varchar(256);default:''"` // allowed scopes, comma separated
+	// BudgetQuota is the quota available in each BudgetPeriod, it works on top of RemainQuota
+	BudgetPeriod    string `json:"budget_period" gorm:"type:varchar(16);default:''"`
+	BudgetQuota     int64  `json:"budget_quota" gorm:"bigint;default:0"`
+	PeriodUsedQuota int64  `json:"period_used_quota" gorm:"bigint;default:0"`
+	PeriodResetTime int64  `json:"period_reset_time" gorm:"bigint;default:0"` // when the current period ends
+	// CostHeaders reports the quota charged for each request in the relay response
+	CostHeaders bool `json:"cost_headers" gorm:"default:false"`
+	RateLimit
+	ParentId int `json:"parent_id" gorm:"index;default:0"` // set on child tokens, see MintChildToken
+	// the user who created the token, a member when UserId is the account of an organization
+	CreatorId int `json:"creator_id" gorm:"index;default:0"`
+	// applied to text requests before the system prompt and model mapping of the channel
+	SystemPrompt     *string `json:"system_prompt" gorm:"type:text"`
+	SystemPromptMode string  `json:"system_prompt_mode" gorm:"type:varchar(16);default:''"` // replace if empty
+	ModelMapping     *string `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
+	// Tags are added to the consume logs of the token, AllowRequestTags lets
+	// requests add more with the X-OneAPI-Tags header, see ParseTags
+	Tags             *string `json:"tags" gorm:"type:varchar(512);default:''"`
+	AllowRequestTags bool    `json:"allow_request_tags" gorm:"default:false"`
+	// limit each end user of the token, 0 means no limit, EndUserQuota is per 24 hours
+	EndUserRateLimit RateLimit `json:"end_user_rate_limit" gorm:"embedded;embeddedPrefix:end_user_"`
+	EndUserQuota     int64     `json:"end_user_quota" gorm:"bigint;default:0"`
+}
+
+// SetKey sets a new key, only its hash and a short prefix are saved.
+func (t *Token) SetKey(key string) {
+	t.Key = key
+	t.KeyHash = common.HashTokenKey(key)
+	prefixLength := 6
+	if len(key)/2 < prefixLength {
+		prefixLength = len(key) / 2
+	}
+	t.KeyPrefix = key[:prefixLength]
+}
+
+// Rotate replaces the key of a token, the current key keeps working for
+// gracePeriod seconds. A key still in its grace period is revoked at once.
+func (t *Token) Rotate(key string, gracePeriod int64) error {
+	oldToken := *t
+	t.PreviousKeyHash, t.PreviousKeyPrefix, t.PreviousKeyExpiredTime = "", "", 0
+	if gracePeriod > 0 {
+		t.PreviousKeyHash = t.KeyHash
+		t.PreviousKeyPrefix = t.KeyPrefix
+		t.PreviousKeyExpiredTime = helper.GetTimestamp() + gracePeriod
+	}
+	t.SetKey(key)
+	err := DB.Model(t).Select("key", "key_prefix", "previous_key_hash", "previous_key_prefix", "previous_key_expired_time").Updates(t).Error
+	if err != nil {
+		return err
+	}
+	// the cached token does not know that its key is now the previous one,
+	// nor that the key which was in its grace period is revoked
+	deleteTokenCache(&oldToken)
+	return nil
+}
+
+// migrateTokenKeys hashes the keys saved before keys were hashed, these
+// tokens have no key prefix.
+func migrateTokenKeys() error {
+	var tokens []*Token
+	migrated := 0
+	err := DB.Select("id", "key").Where("key_prefix = ? or key_prefix is null", "").
+		FindInBatches(&tokens, 100, func(tx *gorm.DB, batch int) error {
+			for _, token := range tokens {
+				// the column is widened before, PostgreSQL pads the legacy char(48) keys with spaces
+				token.SetKey(strings.TrimSpace(token.KeyHash))
+				err := DB.Model(token).Select("key", "key_prefix").Updates(token).Error
+				if err != nil {
+					return err
+				}
+			}
+			migrated += len(tokens)
+			return nil
+		}).Error
+	if migrated > 0 {
+		logger.SysLog(fmt.Sprintf("hashed the keys of %d tokens", migrated))
+	}
+	return err
+}
+
+func IsValidTokenScope(scope string) bool {
+	for _, s := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token may call APIs of the scope. A token
+// without scopes may call everything but the tokens APIs.
+func (t *Token) HasScope(scope string) bool {
+	if t.Scopes == nil || *t.Scopes == "" {
+		return scope != TokenScopeTokens
+	}
+	for _, s := range strings.Split(*t.Scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func IsValidTokenBudgetPeriod(period string) bool {
+	switch period {
+	case TokenBudgetPeriodNone, TokenBudgetPeriodDay, TokenBudgetPeriodWeek, TokenBudgetPeriodMonth:
+		return true
+	}
+	return false
+}
+
+// NextBudgetResetTime returns the start of the period following the one now is in,
+// periods are aligned to local midnight, Monday and the first day of the month.
+func NextBudgetResetTime(period string, now time.Time) int64 {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case TokenBudgetPeriodDay:
+		return today.AddDate(0, 0, 1).Unix()
+	case TokenBudgetPeriodWeek:
+		daysSinceMonday := (int(today.Weekday()) + 6) % 7
+		return today.AddDate(0, 0, 7-daysSinceMonday).Unix()
+	case TokenBudgetPeriodMonth:
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()).Unix()
+	}
+	return 0
+}
+
+func (t *Token) HasBudget() bool {
+	return t.BudgetPeriod != TokenBudgetPeriodNone && t.BudgetQuota > 0
+}
+
+// refreshBudgetPeriod starts a new period in memory if the current one is over,
+// the database is caught up by resetTokenBudgetPeriod.
+func (t *Token) refreshBudgetPeriod() bool {
+	if !t.HasBudget() {
+		return false
+	}
+	now := time.Now()
+	if t.PeriodResetTime > now.Unix() {
+		return false
+	}
+	t.PeriodUsedQuota = 0
+	t.PeriodResetTime = NextBudgetResetTime(t.BudgetPeriod, now)
+	return true
+}
+
+func (t *Token) PeriodRemainQuota() int64 {
+	return t.BudgetQuota - t.PeriodUsedQuota
+}
+
+func resetTokenBudgetPeriod(token *Token) error {
+	oldResetTime := token.PeriodResetTime
+	if !token.refreshBudgetPeriod() {
+		return nil
+	}
+	// the condition keeps concurrent requests from resetting the same period twice
+	return DB.Model(&Token{}).Where("id = ? and period_reset_time = ?", token.Id, oldResetTime).Updates(
+		map[string]interface{}{
+			"period_used_quota": 0,
+			"period_reset_time": token.PeriodResetTime,
+		},
+	).Error
+}
+
+// SetBudgetPeriod switches the token to another budget period, which starts with nothing used.
+// The usage is not written by Update, the copy in memory may be behind the consumption.
+func (t *Token) SetBudgetPeriod(period string) error {
+	if t.BudgetPeriod == period {
+		return nil
+	}
+	oldPeriod := t.BudgetPeriod
+	t.BudgetPeriod = period
+	t.PeriodUsedQuota = 0
+	t.PeriodResetTime = NextBudgetResetTime(period, time.Now())
+	return DB.Model(&Token{}).Where("id = ? and budget_period = ?", t.Id, oldPeriod).Updates(
+		map[string]interface{}{
+			"budget_period":     t.BudgetPeriod,
+			"period_used_quota": 0,
+			"period_reset_time": t.PeriodResetTime,
+		},
+	).Error
+}
+
+// loadBudgetUsage reads the usage of the current period from the database,
+// the cached token does not see the consumption since it was cached.
+func (t *Token) loadBudgetUsage() error {
+	usage := Token{}
+	err := DB.Model(&Token{}).Select("period_used_quota", "period_reset_time").Where("id = ?", t.Id).Take(&usage).Error
+	if err != nil {
+		return err
+	}
+	t.PeriodUsedQuota = usage.PeriodUsedQuota
+	t.PeriodResetTime = usage.PeriodResetTime
+	return nil
+}
+
+// CheckTokenBudget makes sure the current period of the token has quota left,
+// it is also used when the quota is not pre-consumed.
+func CheckTokenBudget(tokenId int, quota int64) error {
+	token, err := GetTokenById(tokenId)
+	if err != nil {
+		return err
+	}
+	return checkTokenBudget(token, quota)
+}
+
+// checkTokenBudget also checks the budget of the parent of a child token.
+func checkTokenBudget(token *Token, quota int64) error {
+	if err := resetTokenBudgetPeriod(token); err != nil {
+		return err
+	}
+	if token.HasBudget() && token.PeriodRemainQuota() < quota {
+		return errors.New("令牌本周期额度不足")
+	}
+	if token.ParentId == 0 {
+		return nil
+	}
+	parent, err := GetTokenById(token.ParentId)
+	if err != nil {
+		return err
+	}
+	if err = resetTokenBudgetPeriod(parent); err != nil {
+		return err
+	}
+	if parent.HasBudget() && parent.PeriodRemainQuota() < quota {
+		return errors.New("父令牌本周期额度不足")
+	}
+	return nil
+}
+
+// LimitId is the token whose rate limits and end user quota a request counts
+// against, child tokens share the ones of their parent.
+func (t *Token) LimitId() int {
+	if t.ParentId != 0 {
+		return t.ParentId
+	}
+	return t.Id
+}
+
+// applyParentToken holds a child token to the current budget and limits of its parent.
+func applyParentToken(token *Token) error {
+	parent, err := GetTokenById(token.ParentId)
+	if err != nil {
+		return err
+	}
+	parent.refreshBudgetPeriod()
+	if parent.HasBudget() && parent.PeriodRemainQuota() <= 0 {
+		return fmt.Errorf("父令牌本周期额度已用尽，将于 %s 重置", time.Unix(parent.PeriodResetTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	token.RateLimit = parent.RateLimit
+	token.EndUserRateLimit = parent.EndUserRateLimit
+	token.EndUserQuota = parent.EndUserQuota
+	return nil
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token, error) {
@@ -51,11 +344,17 @@ func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token
 	}
 
 	err = query.Limit(num).Offset(startIdx).Find(&tokens).Error
+	for _, token := range tokens {
+		token.refreshBudgetPeriod()
+	}
 	return tokens, err
 }
 
 func SearchUserTokens(userId int, keyword string) (tokens []*Token, err error) {
 	err = DB.Where("user_id = ?", userId).Where("name LIKE ?", keyword+"%").Find(&tokens).Error
+	for _, token := range tokens {
+		token.refreshBudgetPeriod()
+	}
 	return tokens, err
 }
 
@@ -71,6 +370,9 @@ func ValidateUserToken(key string) (token *Token, err error) {
 		}
 		return nil, errors.New("令牌验证失败")
 	}
+	if token.UsingPreviousKey && token.PreviousKeyExpiredTime <= helper.GetTimestamp() {
+		return nil, errors.New("该令牌密钥已轮换并失效，请使用新密钥")
+	}
 	if token.Status == TokenStatusExhausted {
 		return nil, fmt.Errorf("令牌 %s（#%d）额度已用尽", token.Name, token.Id)
 	} else if token.Status == TokenStatusExpired {
@@ -100,6 +402,24 @@ func ValidateUserToken(key string) (token *Token, err error) {
 		}
 		return nil, errors.New("该令牌额度已用尽")
 	}
+	if token.HasBudget() {
+		if err := token.loadBudgetUsage(); err != nil {
+			logger.SysError("failed to load token budget usage: " + err.Error())
+			return nil, errors.New("令牌验证失败")
+		}
+	}
+	token.refreshBudgetPeriod()
+	if token.HasBudget() && token.PeriodRemainQuota() <= 0 {
+		return nil, fmt.Errorf("该令牌本周期额度已用尽，将于 %s 重置", time.Unix(token.PeriodResetTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	if token.ParentId != 0 {
+		if err := applyParentToken(token); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("父令牌不存在")
+			}
+			return nil, err
+		}
+	}
 	return token, nil
 }
 
@@ -110,6 +430,7 @@ func GetTokenByIds(id int, userId int) (*Token, error) {
 	token := Token{Id: id, UserId: userId}
 	var err error = nil
 	err = DB.First(&token, "id = ? and user_id = ?", id, userId).Error
+	token.refreshBudgetPeriod()
 	return &token, err
 }
 
@@ -132,7 +453,10 @@ func (t *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (t *Token) Update() error {
 	var err error
-	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(t).Error
+	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet", "scopes",
+		"budget_quota", "cost_headers", "rpm", "tpm", "rpd",
+		"system_prompt", "system_prompt_mode", "model_mapping", "tags", "allow_request_tags",
+		"end_user_rpm", "end_user_tpm", "end_user_rpd", "end_user_quota").Updates(t).Error
 	return err
 }
 
@@ -147,6 +471,39 @@ func (t *Token) Delete() error {
 	return err
 }
 
+func IsValidTokenSystemPromptMode(mode string) bool {
+	return mode == "" || mode == TokenSystemPromptModeReplace || mode == TokenSystemPromptModePrepend
+}
+
+func (t *Token) GetTags() string {
+	if t.Tags == nil {
+		return ""
+	}
+	return *t.Tags
+}
+
+func (t *Token) GetSystemPrompt() string {
+	if t.SystemPrompt == nil {
+		return ""
+	}
+	return *t.SystemPrompt
+}
+
+// GetModelMapping maps the model names requested with the token, like the
+// model mapping of a channel.
+func (t *Token) GetModelMapping() map[string]string {
+	if t.ModelMapping == nil || *t.ModelMapping == "" || *t.ModelMapping == "{}" {
+		return nil
+	}
+	modelMapping := make(map[string]string)
+	err := json.Unmarshal([]byte(*t.ModelMapping), &modelMapping)
+	if err != nil {
+		logger.SysError(fmt.Sprintf("failed to unmarshal model mapping for token %d, error: %s", t.Id, err.Error()))
+		return nil
+	}
+	return modelMapping
+}
+
 func (t *Token) GetModels() string {
 	if t == nil {
 		return ""
@@ -167,54 +524,70 @@ func DeleteTokenById(id int, userId int) (err error) {
 	if err != nil {
 		return err
 	}
+	err = RevokeChildTokens(context.Background(), &token)
+	if err != nil {
+		return err
+	}
 	return token.Delete()
 }
 
-func IncreaseTokenQuota(id int, quota int64) (err error) {
+func IncreaseTokenQuota(ctx context.Context, token *Token, quota int64, reason string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	entry := newLedgerEntry(ctx, LedgerAccountToken, token.Id, token.UserId, quota, reason)
 	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, quota)
+		addNewLedgerRecord(BatchUpdateTypeTokenQuota, token.Id, quota, entry)
 		return nil
 	}
-	return increaseTokenQuota(id, quota)
+	return increaseTokenQuota(token.Id, quota, entry)
 }
 
-func increaseTokenQuota(id int, quota int64) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"remain_quota":  gorm.Expr("remain_quota + ?", quota),
-			"used_quota":    gorm.Expr("used_quota - ?", quota),
-			"accessed_time": helper.GetTimestamp(),
-		},
-	).Error
-	return err
+func increaseTokenQuota(id int, quota int64, entries ...*QuotaLedger) (err error) {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Token{}).Where("id = ?", id).Updates(
+			map[string]interface{}{
+				"remain_quota":  gorm.Expr("remain_quota + ?", quota),
+				"used_quota":    gorm.Expr("used_quota - ?", quota),
+				"accessed_time": helper.GetTimestamp(),
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+		return appendLedgerEntries(tx, LedgerAccountToken, id, entries)
+	})
 }
 
-func DecreaseTokenQuota(id int, quota int64) (err error) {
+func DecreaseTokenQuota(ctx context.Context, token *Token, quota int64, reason string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	entry := newLedgerEntry(ctx, LedgerAccountToken, token.Id, token.UserId, -quota, reason)
 	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, -quota)
+		addNewLedgerRecord(BatchUpdateTypeTokenQuota, token.Id, -quota, entry)
 		return nil
 	}
-	return decreaseTokenQuota(id, quota)
+	return decreaseTokenQuota(token.Id, quota, entry)
 }
 
-func decreaseTokenQuota(id int, quota int64) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"remain_quota":  gorm.Expr("remain_quota - ?", quota),
-			"used_quota":    gorm.Expr("used_quota + ?", quota),
-			"accessed_time": helper.GetTimestamp(),
-		},
-	).Error
-	return err
+func decreaseTokenQuota(id int, quota int64, entries ...*QuotaLedger) (err error) {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Token{}).Where("id = ?", id).Updates(
+			map[string]interface{}{
+				"remain_quota":  gorm.Expr("remain_quota - ?", quota),
+				"used_quota":    gorm.Expr("used_quota + ?", quota),
+				"accessed_time": helper.GetTimestamp(),
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+		return appendLedgerEntries(tx, LedgerAccountToken, id, entries)
+	})
 }
 
-func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
+func PreConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -225,6 +598,9 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
 		return errors.New("令牌额度不足")
 	}
+	if err = checkTokenBudget(token, quota); err != nil {
+		return err
+	}
 	userQuota, err := GetUserQuota(token.UserId)
 	if err != nil {
 		return err
@@ -240,6 +616,10 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 			if err != nil {
 				logger.SysError("failed to fetch user email: " + err.Error())
 			}
+			currency, err := GetUserDisplayCurrency(token.UserId)
+			if err != nil {
+				logger.SysError("failed to fetch user display currency: " + err.Error())
+			}
 			prompt := "额度提醒"
 			var contentText string
 			if noMoreQuota {
@@ -253,14 +633,14 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 					prompt,
 					fmt.Sprintf(`
 						<p>您好！</p>
-						<p>%s，当前剩余额度为 <strong>%d</strong>。</p>
+						<p>%s，当前剩余额度为 <strong>%s</strong>。</p>
 						<p>为了不影响您的使用，请及时充值。</p>
 						<p style="text-align: center; margin: 30px 0;">
 							<a href="%s" style="background-color: #007bff; color: white; padding: 12px 24px; text-decoration: none; border-radius: 4px; display: inline-block;">立即充值</a>
 						</p>
 						<p style="color: #666;">如果按钮无法点击，请复制以下链接到浏览器中打开：</p>
 						<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px; word-break: break-all;">%s</p>
-					`, contentText, userQuota, topUpLink, topUpLink),
+					`, contentText, common.FormatQuota(userQuota, currency), topUpLink, topUpLink),
 				)
 				err = message.SendEmail(prompt, email, content)
 				if err != nil {
@@ -270,34 +650,86 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 		}()
 	}
 	if !token.UnlimitedQuota {
-		err = DecreaseTokenQuota(tokenId, quota)
+		err = DecreaseTokenQuota(ctx, token, quota, LedgerReasonPreConsume)
 		if err != nil {
 			return err
 		}
 	}
-	err = DecreaseUserQuota(token.UserId, quota)
+	addTokenUsage(ctx, token, quota)
+	err = DecreaseUserQuota(ctx, token.UserId, quota, LedgerReasonPreConsume)
 	return err
 }
 
-func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
+func PostConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err error) {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
 		return err
 	}
 	if quota > 0 {
-		err = DecreaseUserQuota(token.UserId, quota)
+		err = DecreaseUserQuota(ctx, token.UserId, quota, LedgerReasonConsume)
 	} else {
-		err = IncreaseUserQuota(token.UserId, -quota)
+		err = IncreaseUserQuota(ctx, token.UserId, -quota, LedgerReasonRefund)
 	}
 	if !token.UnlimitedQuota {
 		if quota > 0 {
-			err = DecreaseTokenQuota(tokenId, quota)
+			err = DecreaseTokenQuota(ctx, token, quota, LedgerReasonConsume)
 		} else {
-			err = IncreaseTokenQuota(tokenId, -quota)
+			err = IncreaseTokenQuota(ctx, token, -quota, LedgerReasonRefund)
 		}
 		if err != nil {
 			return err
 		}
 	}
+	addTokenUsage(ctx, token, quota)
 	return nil
 }
+
+// addTokenUsage counts quota against the budget period and the end user quota
+// of the token, a child token counts against the ones of its parent instead.
+func addTokenUsage(ctx context.Context, token *Token, quota int64) {
+	addTokenPeriodUsage(ctx, token, quota)
+	if token.ParentId == 0 {
+		addEndUserQuota(ctx, token, quota)
+		return
+	}
+	UpdateTokenUsedQuota(token.ParentId, quota)
+	parent, err := GetTokenById(token.ParentId)
+	if err != nil {
+		logger.Error(ctx, fmt.Sprintf("failed to get parent token #%d: %s", token.ParentId, err.Error()))
+		return
+	}
+	addTokenPeriodUsage(ctx, parent, quota)
+	addEndUserQuota(ctx, parent, quota)
+}
+
+// addTokenPeriodUsage counts quota against the current budget period of the token.
+func addTokenPeriodUsage(ctx context.Context, token *Token, quota int64) {
+	if !token.HasBudget() {
+		return
+	}
+	if err := resetTokenBudgetPeriod(token); err != nil {
+		logger.Error(ctx, fmt.Sprintf("failed to reset budget period of token #%d: %s", token.Id, err.Error()))
+		return
+	}
+	UpdateTokenPeriodUsedQuota(token.Id, token.PeriodResetTime, quota)
+}
+
+// UpdateTokenPeriodUsedQuota counts quota against the budget period that ends
+// at periodResetTime, it is dropped if the period is over when it is written.
+// It is also used for tokens with unlimited quota, whose remain_quota is never touched.
+func UpdateTokenPeriodUsedQuota(id int, periodResetTime int64, quota int64) {
+	if config.BatchUpdateEnabled {
+		addNewTokenPeriodRecord(id, periodResetTime, quota)
+		return
+	}
+	updateTokenPeriodUsedQuota(id, periodResetTime, quota)
+}
+
+func updateTokenPeriodUsedQuota(id int, periodResetTime int64, quota int64) {
+	// a refund of a request made in the previous period can't take the usage below 0
+	err := DB.Model(&Token{}).Where("id = ? and period_reset_time = ?", id, periodResetTime).
+		Update("period_used_quota", gorm.Expr("case when period_used_quota + ? < 0 then 0 else period_used_quota + ? end", quota, quota)).Error
+	if err != nil {
+		logger.SysError("failed to update token period used quota: " + err.Error())
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNextBudgetResetTime(t *testing.T) {
+	location := time.FixedZone("UTC+8", 8*3600)
+	date := func(year int, month time.Month, day int, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, location)
+	}
+	Convey("day", t, func() {
+		So(NextBudgetResetTime(TokenBudgetPeriodDay, date(2024, 3, 10, 15)), ShouldEqual, date(2024, 3, 11, 0).Unix())
+		So(NextBudgetResetTime(TokenBudgetPeriodDay, date(2024, 2, 29, 0)), ShouldEqual, date(2024, 3, 1, 0).Unix())
+	})
+	Convey("week", t, func() {
+		// 2024-03-10 is a Sunday and 2024-03-11 a Monday
+		So(NextBudgetResetTime(TokenBudgetPeriodWeek, date(2024, 3, 10, 23)), ShouldEqual, date(2024, 3, 11, 0).Unix())
+		So(NextBudgetResetTime(TokenBudgetPeriodWeek, date(2024, 3, 11, 0)), ShouldEqual, date(2024, 3, 18, 0).Unix())
+		So(NextBudgetResetTime(TokenBudgetPeriodWeek, date(2024, 3, 13, 12)), ShouldEqual, date(2024, 3, 18, 0).Unix())
+	})
+	Convey("month", t, func() {
+		So(NextBudgetResetTime(TokenBudgetPeriodMonth, date(2024, 1, 31, 12)), ShouldEqual, date(2024, 2, 1, 0).Unix())
+		So(NextBudgetResetTime(TokenBudgetPeriodMonth, date(2024, 12, 15, 8)), ShouldEqual, date(2025, 1, 1, 0).Unix())
+	})
+	Convey("none", t, func() {
+		So(NextBudgetResetTime(TokenBudgetPeriodNone, date(2024, 3, 10, 15)), ShouldEqual, 0)
+	})
+}
+
+func TestHasScope(t *testing.T) {
+	scopes := func(s string) *string {
+		return &s
+	}
+	tests := []struct {
+		name   string
+		scopes *string
+		scope  string
+		want   bool
+	}{
+		{"nil scopes allow chat", nil, TokenScopeChat, true},
+		{"nil scopes deny tokens", nil, TokenScopeTokens, false},
+		{"empty scopes allow images", scopes(""), TokenScopeImages, true},
+		{"empty scopes deny tokens", scopes(""), TokenScopeTokens, false},
+		{"listed scope", scopes("chat,embeddings"), TokenScopeEmbeddings, true},
+		{"unlisted scope", scopes("chat,embeddings"), TokenScopeImages, false},
+		{"tokens granted explicitly", scopes("chat,tokens"), TokenScopeTokens, true},
+		{"only tokens", scopes("tokens"), TokenScopeChat, false},
+	}
+	for _, tt := range tests {
+		Convey(tt.name, t, func() {
+			token := &Token{Scopes: tt.scopes}
+			So(token.HasScope(tt.scope), ShouldEqual, tt.want)
+		})
+	}
+}
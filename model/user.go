@@ -51,7 +51,25 @@ type User struct {
 	Group            string `json:"group" gorm:"type:varchar(32);default:'default'"`
 	AffCode          string `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
 	InviterId        int    `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
-}
+	DisplayCurrency  string `json:"display_currency" gorm:"type:varchar(8);default:''"` // empty means config.DisplayCurrency
+	// subscription state, only changed through the plan API
+	PlanId            int    `json:"plan_id" gorm:"type:int;default:0;index"`
+	PlanExpiredTime   int64  `json:"plan_expired_time" gorm:"bigint;default:0"` // 0 means never expires
+	PlanNextGrantTime int64  `json:"plan_next_grant_time" gorm:"bigint;default:0;index"`
+	PlanGrantedQuota  int64  `json:"plan_granted_quota" gorm:"bigint;default:0"` // quota of the latest grant
+	PlanUsedQuotaMark int64  `json:"-" gorm:"bigint;default:0"`                  // used_quota at the latest grant
+	PlanPreviousGroup string `json:"-" gorm:"type:varchar(32);default:''"`       // restored when the plan ends
+	// referral commission, only changed by settlement and transfer
+	AffQuota        int64 `json:"aff_quota" gorm:"bigint;default:0"`               // not yet transferred to quota
+	AffHistoryQuota int64 `json:"aff_history_quota" gorm:"bigint;default:0"`       // ever earned
+	OrganizationId  int   `json:"organization_id" gorm:"type:int;default:0;index"` // set on the account of an organization
+	AdminRoleId     int   `json:"admin_role_id" gorm:"type:int;default:0;index"`   // replaces the default permissions, see AdminRole
+	RateLimit
+}
+
+// userManagedColumns are only changed through their own APIs, never by User.Update
+var userManagedColumns = []string{"plan_id", "plan_expired_time", "plan_next_grant_time", "plan_granted_quota", "plan_used_quota_mark", "plan_previous_group",
+	"aff_quota", "aff_history_quota", "organization_id", "admin_role_id"}
 
 func GetMaxUserId() int {
 	var user User
@@ -60,7 +78,8 @@ func GetMaxUserId() int {
 }
 
 func GetAllUsers(startIdx int, num int, order string) (users []*User, err error) {
-	query := DB.Limit(num).Offset(startIdx).Omit("password").Where("status != ?", UserStatusDeleted)
+	// the accounts of organizations are managed through their organizations
+	query := DB.Limit(num).Offset(startIdx).Omit("password").Where("status != ? and organization_id = 0", UserStatusDeleted)
 
 	switch order {
 	case "quota":
@@ -78,10 +97,11 @@ func GetAllUsers(startIdx int, num int, order string) (users []*User, err error)
 }
 
 func SearchUsers(keyword string) (users []*User, err error) {
+	query := DB.Omit("password").Where("organization_id = 0")
 	if !common.UsingPostgreSQL {
-		err = DB.Omit("password").Where("id = ? or username LIKE ? or email LIKE ? or display_name LIKE ?", keyword, keyword+"%", keyword+"%", keyword+"%").Find(&users).Error
+		err = query.Where("id = ? or username LIKE ? or email LIKE ? or display_name LIKE ?", keyword, keyword+"%", keyword+"%", keyword+"%").Find(&users).Error
 	} else {
-		err = DB.Omit("password").Where("username LIKE ? or email LIKE ? or display_name LIKE ?", keyword+"%", keyword+"%", keyword+"%").Find(&users).Error
+		err = query.Where("username LIKE ? or email LIKE ? or display_name LIKE ?", keyword+"%", keyword+"%", keyword+"%").Find(&users).Error
 	}
 	return users, err
 }
@@ -117,6 +137,12 @@ func DeleteUserById(id int) (err error) {
 	return user.Delete()
 }
 
+// IsOrganizationAccount reports whether the user is the account of an
+// organization, which is managed through the organization instead.
+func (user *User) IsOrganizationAccount() bool {
+	return user.OrganizationId != 0
+}
+
 func (user *User) Insert(ctx context.Context, inviterId int) error {
 	var err error
 	if user.Password != "" {
@@ -133,29 +159,31 @@ func (user *User) Insert(ctx context.Context, inviterId int) error {
 		return result.Error
 	}
 	if config.QuotaForNewUser > 0 {
+		RecordQuotaAdjustment(ctx, LedgerAccountUser, user.Id, user.Id, config.QuotaForNewUser, LedgerReasonRegister, "")
 		RecordLog(ctx, user.Id, LogTypeSystem, fmt.Sprintf("新用户注册赠送 %s", common.LogQuota(config.QuotaForNewUser)))
 	}
 	if inviterId != 0 {
 		if config.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, config.QuotaForInvitee)
+			_ = IncreaseUserQuota(ctx, user.Id, config.QuotaForInvitee, LedgerReasonInvite)
 			RecordLog(ctx, user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", common.LogQuota(config.QuotaForInvitee)))
 		}
 		if config.QuotaForInviter > 0 {
-			_ = IncreaseUserQuota(inviterId, config.QuotaForInviter)
+			_ = IncreaseUserQuota(ctx, inviterId, config.QuotaForInviter, LedgerReasonInvite)
 			RecordLog(ctx, inviterId, LogTypeSystem, fmt.Sprintf("邀请用户赠送 %s", common.LogQuota(config.QuotaForInviter)))
 		}
 	}
 	// create default token
 	cleanToken := Token{
 		UserId:         user.Id,
+		CreatorId:      user.Id,
 		Name:           "default",
-		Key:            random.GenerateKey(),
 		CreatedTime:    helper.GetTimestamp(),
 		AccessedTime:   helper.GetTimestamp(),
 		ExpiredTime:    -1,
 		RemainQuota:    -1,
 		UnlimitedQuota: true,
 	}
+	cleanToken.SetKey(random.GenerateKey())
 	result.Error = cleanToken.Insert()
 	if result.Error != nil {
 		// do not block
@@ -177,7 +205,7 @@ func (user *User) Update(updatePassword bool) error {
 	} else if user.Status == UserStatusEnabled {
 		blacklist.UnbanUser(user.Id)
 	}
-	err = DB.Model(user).Updates(user).Error
+	err = DB.Model(user).Omit(userManagedColumns...).Updates(user).Error
 	return err
 }
 
@@ -211,7 +239,7 @@ func (user *User) ValidateAndFill() (err error) {
 		}
 	}
 	okay := common.ValidatePasswordAndHash(password, user.Password)
-	if !okay || user.Status != UserStatusEnabled {
+	if !okay || user.Status != UserStatusEnabled || user.OrganizationId != 0 {
 		return errors.New("用户名或密码错误，或用户已被封禁")
 	}
 	return nil
@@ -340,7 +368,8 @@ func ValidateAccessToken(token string) (user *User) {
 	}
 	token = strings.Replace(token, "Bearer ", "", 1)
 	user = &User{}
-	if DB.Where("access_token = ?", token).First(user).RowsAffected == 1 {
+	// the accounts of organizations are only used through their members
+	if DB.Where("access_token = ? and organization_id = 0", token).First(user).RowsAffected == 1 {
 		return user
 	}
 	return nil
@@ -361,6 +390,16 @@ func GetUserEmail(id int) (email string, err error) {
 	return email, err
 }
 
+func GetUserDisplayCurrency(id int) (currency string, err error) {
+	err = DB.Model(&User{}).Where("id = ?", id).Select("display_currency").Find(&currency).Error
+	return currency, err
+}
+
+// SetUserDisplayCurrency also writes "", which Update skips as a zero value.
+func SetUserDisplayCurrency(id int, currency string) error {
+	return DB.Model(&User{}).Where("id = ?", id).Update("display_currency", currency).Error
+}
+
 func GetUserGroup(id int) (group string, err error) {
 	groupCol := "`group`"
 	if common.UsingPostgreSQL {
@@ -371,36 +410,48 @@ func GetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
-func IncreaseUserQuota(id int, quota int64) (err error) {
+func IncreaseUserQuota(ctx context.Context, id int, quota int64, reason string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	entry := newLedgerEntry(ctx, LedgerAccountUser, id, id, quota, reason)
 	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
+		addNewLedgerRecord(BatchUpdateTypeUserQuota, id, quota, entry)
 		return nil
 	}
-	return increaseUserQuota(id, quota)
+	return increaseUserQuota(id, quota, entry)
 }
 
-func increaseUserQuota(id int, quota int64) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
-	return err
+func increaseUserQuota(id int, quota int64, entries ...*QuotaLedger) (err error) {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
+		if err != nil {
+			return err
+		}
+		return appendLedgerEntries(tx, LedgerAccountUser, id, entries)
+	})
 }
 
-func DecreaseUserQuota(id int, quota int64) (err error) {
+func DecreaseUserQuota(ctx context.Context, id int, quota int64, reason string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	entry := newLedgerEntry(ctx, LedgerAccountUser, id, id, -quota, reason)
 	if config.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
+		addNewLedgerRecord(BatchUpdateTypeUserQuota, id, -quota, entry)
 		return nil
 	}
-	return decreaseUserQuota(id, quota)
+	return decreaseUserQuota(id, quota, entry)
 }
 
-func decreaseUserQuota(id int, quota int64) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
-	return err
+func decreaseUserQuota(id int, quota int64, entries ...*QuotaLedger) (err error) {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
+		if err != nil {
+			return err
+		}
+		return appendLedgerEntries(tx, LedgerAccountUser, id, entries)
+	})
 }
 
 func GetRootUserEmail() (email string) {
@@ -13,15 +13,23 @@ const (
 	BatchUpdateTypeUsedQuota
 	BatchUpdateTypeChannelUsedQuota
 	BatchUpdateTypeRequestCount
+	BatchUpdateTypeTokenPeriodUsedQuota
+	BatchUpdateTypeTokenUsedQuota
 	BatchUpdateTypeCount // if you add a new type, you need to add a new map and a new lock
 )
 
 var batchUpdateStores []map[int]int64
+var batchUpdateLedgers []map[int][]*QuotaLedger
 var batchUpdateLocks []sync.Mutex
 
+// batchUpdateTokenPeriods is the budget period of the pending period usage of
+// each token, guarded by the lock of BatchUpdateTypeTokenPeriodUsedQuota.
+var batchUpdateTokenPeriods = make(map[int]int64)
+
 func init() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateStores = append(batchUpdateStores, make(map[int]int64))
+		batchUpdateLedgers = append(batchUpdateLedgers, make(map[int][]*QuotaLedger))
 		batchUpdateLocks = append(batchUpdateLocks, sync.Mutex{})
 	}
 }
@@ -45,23 +53,54 @@ func addNewRecord(type_ int, id int, value int64) {
 	}
 }
 
+// addNewLedgerRecord keeps the ledger entry next to the pending delta, so both
+// are written in the same transaction when the batch is flushed.
+func addNewLedgerRecord(type_ int, id int, value int64, entry *QuotaLedger) {
+	batchUpdateLocks[type_].Lock()
+	defer batchUpdateLocks[type_].Unlock()
+	batchUpdateStores[type_][id] += value
+	batchUpdateLedgers[type_][id] = append(batchUpdateLedgers[type_][id], entry)
+}
+
+// addNewTokenPeriodRecord keeps the pending period usage of a token for one
+// budget period, the usage of a period that is over is dropped.
+func addNewTokenPeriodRecord(id int, periodResetTime int64, value int64) {
+	batchUpdateLocks[BatchUpdateTypeTokenPeriodUsedQuota].Lock()
+	defer batchUpdateLocks[BatchUpdateTypeTokenPeriodUsedQuota].Unlock()
+	if pending, ok := batchUpdateTokenPeriods[id]; ok && pending != periodResetTime {
+		if periodResetTime < pending {
+			return
+		}
+		delete(batchUpdateStores[BatchUpdateTypeTokenPeriodUsedQuota], id)
+	}
+	batchUpdateTokenPeriods[id] = periodResetTime
+	batchUpdateStores[BatchUpdateTypeTokenPeriodUsedQuota][id] += value
+}
+
 func batchUpdate() {
 	logger.SysLog("batch update started")
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateLocks[i].Lock()
 		store := batchUpdateStores[i]
+		ledgers := batchUpdateLedgers[i]
 		batchUpdateStores[i] = make(map[int]int64)
+		batchUpdateLedgers[i] = make(map[int][]*QuotaLedger)
+		var periods map[int]int64
+		if i == BatchUpdateTypeTokenPeriodUsedQuota {
+			periods = batchUpdateTokenPeriods
+			batchUpdateTokenPeriods = make(map[int]int64)
+		}
 		batchUpdateLocks[i].Unlock()
 		// TODO: maybe we can combine updates with same key?
 		for key, value := range store {
 			switch i {
 			case BatchUpdateTypeUserQuota:
-				err := increaseUserQuota(key, value)
+				err := increaseUserQuota(key, value, ledgers[key]...)
 				if err != nil {
 					logger.SysError("failed to batch update user quota: " + err.Error())
 				}
 			case BatchUpdateTypeTokenQuota:
-				err := increaseTokenQuota(key, value)
+				err := increaseTokenQuota(key, value, ledgers[key]...)
 				if err != nil {
 					logger.SysError("failed to batch update token quota: " + err.Error())
 				}
@@ -71,6 +110,10 @@ func batchUpdate() {
 				updateUserRequestCount(key, int(value))
 			case BatchUpdateTypeChannelUsedQuota:
 				updateChannelUsedQuota(key, value)
+			case BatchUpdateTypeTokenPeriodUsedQuota:
+				updateTokenPeriodUsedQuota(key, periods[key], value)
+			case BatchUpdateTypeTokenUsedQuota:
+				updateTokenUsedQuota(key, value)
 			}
 		}
 	}
@@ -14,6 +14,7 @@ import (
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/model"
 )
 
@@ -73,6 +74,10 @@ func ConvertImageRequest(request model.ImageRequest) *ImageRequest {
 	imageRequest.Model = request.Model
 	imageRequest.Parameters.Size = strings.Replace(request.Size, "x", "*", -1)
 	imageRequest.Parameters.N = request.N
+	// only the models with styles in the image price table take one, e.g. wanx-v1
+	if price := ratio.GetImagePrice(request.Model); price != nil && price.Styles != nil {
+		imageRequest.Parameters.Style = request.Style
+	}
 	imageRequest.ResponseFormat = request.ResponseFormat
 
 	return &imageRequest
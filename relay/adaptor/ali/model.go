@@ -44,6 +44,7 @@ type ImageRequest struct {
 		N     int    `json:"n,omitempty"`
 		Steps string `json:"steps,omitempty"`
 		Scale string `json:"scale,omitempty"`
+		Style string `json:"style,omitempty"`
 	} `json:"parameters,omitempty"`
 	ResponseFormat string `json:"response_format,omitempty"`
 }
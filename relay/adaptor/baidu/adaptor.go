@@ -24,6 +24,9 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 	// https://cloud.baidu.com/doc/WENXINWORKSHOP/s/clntwmv7t
 	suffix := "chat/"
+	if meta.Mode == relaymode.ImagesGenerations {
+		suffix = "text2image/"
+	}
 	if strings.HasPrefix(meta.ActualModelName, "Embedding") {
 		suffix = "embeddings/"
 	}
@@ -76,6 +79,8 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 		suffix += "bge_large_en"
 	case "tao-8k":
 		suffix += "tao_8k"
+	case "Stable-Diffusion-XL":
+		suffix += "sd_xl"
 	default:
 		suffix += strings.ToLower(meta.ActualModelName)
 	}
@@ -113,7 +118,7 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	return request, nil
+	return ConvertImageRequest(*request), nil
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
@@ -127,6 +132,8 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 		switch meta.Mode {
 		case relaymode.Embeddings:
 			err, usage = EmbeddingHandler(c, resp)
+		case relaymode.ImagesGenerations:
+			err, usage = ImageHandler(c, resp)
 		default:
 			err, usage = Handler(c, resp)
 		}
@@ -136,6 +136,30 @@ func embeddingResponseBaidu2OpenAI(response *EmbeddingResponse) *openai.Embeddin
 	return &openAIEmbeddingResponse
 }
 
+func ConvertImageRequest(request model.ImageRequest) *ImageRequest {
+	return &ImageRequest{
+		Prompt: request.Prompt,
+		Size:   request.Size,
+		N:      request.N,
+		Style:  request.Style,
+		UserId: request.User,
+	}
+}
+
+// responseBaidu2OpenAIImage always returns b64_json, the images are not hosted by Baidu.
+func responseBaidu2OpenAIImage(response *ImageResponse) *openai.ImageResponse {
+	imageResponse := openai.ImageResponse{
+		Created: response.Created,
+		Data:    make([]openai.ImageData, 0, len(response.Data)),
+	}
+	for _, data := range response.Data {
+		imageResponse.Data = append(imageResponse.Data, openai.ImageData{
+			B64Json: data.B64Image,
+		})
+	}
+	return &imageResponse
+}
+
 func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
 	var usage model.Usage
 	scanner := bufio.NewScanner(resp.Body)
@@ -254,6 +278,42 @@ func EmbeddingHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStat
 	return nil, &fullTextResponse.Usage
 }
 
+func ImageHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage) {
+	var baiduResponse ImageResponse
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = json.Unmarshal(responseBody, &baiduResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if baiduResponse.ErrorMsg != "" {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: baiduResponse.ErrorMsg,
+				Type:    "baidu_error",
+				Param:   "",
+				Code:    baiduResponse.ErrorCode,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	fullTextResponse := responseBaidu2OpenAIImage(&baiduResponse)
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, nil
+}
+
 func GetAccessToken(apiKey string) (string, error) {
 	if val, ok := baiduTokenStore.Load(apiKey); ok {
 		var accessToken AccessToken
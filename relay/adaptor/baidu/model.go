@@ -41,6 +41,31 @@ type EmbeddingResponse struct {
 	Error
 }
 
+// ImageRequest is the request of the text2image models, sizes and styles are
+// the ones of the image price table, see ratio.ImagePrices.
+type ImageRequest struct {
+	Prompt string `json:"prompt"`
+	Size   string `json:"size,omitempty"`
+	N      int    `json:"n,omitempty"`
+	Style  string `json:"style,omitempty"`
+	UserId string `json:"user_id,omitempty"`
+}
+
+type ImageData struct {
+	Object   string `json:"object"`
+	B64Image string `json:"b64_image"`
+	Index    int    `json:"index"`
+}
+
+type ImageResponse struct {
+	Id      string      `json:"id"`
+	Object  string      `json:"object"`
+	Created int64       `json:"created"`
+	Data    []ImageData `json:"data"`
+	Usage   model.Usage `json:"usage"`
+	Error
+}
+
 type AccessToken struct {
 	AccessToken      string    `json:"access_token"`
 	Error            string    `json:"error,omitempty"`
@@ -18,7 +18,7 @@ var ModelList = []string{
 	"text-moderation-latest", "text-moderation-stable",
 	"text-davinci-edit-001",
 	"davinci-002", "babbage-002",
-	"dall-e-2", "dall-e-3",
+	"dall-e-2", "dall-e-3", "gpt-image-1",
 	"whisper-1",
 	"tts-1", "tts-1-1106", "tts-1-hd", "tts-1-hd-1106",
 	"o1", "o1-2024-12-17",
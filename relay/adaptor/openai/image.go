@@ -28,6 +28,10 @@ func ImageHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCo
 	resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
 
 	for k, v := range resp.Header {
+		if c.Writer.Header().Get(k) != "" {
+			// keep the headers set by One API, e.g. x-ratelimit-*
+			continue
+		}
 		c.Writer.Header().Set(k, v[0])
 	}
 	c.Writer.WriteHeader(resp.StatusCode)
@@ -40,5 +44,16 @@ func ImageHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCo
 	if err != nil {
 		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
 	}
-	return nil, nil
+	if imageResponse.Usage == nil {
+		return nil, nil
+	}
+	return nil, &model.Usage{
+		PromptTokens:     imageResponse.Usage.InputTokens,
+		CompletionTokens: imageResponse.Usage.OutputTokens,
+		TotalTokens:      imageResponse.Usage.TotalTokens,
+		PromptTokensDetails: &model.PromptTokensDetails{
+			TextTokens:  imageResponse.Usage.InputTokensDetails.TextTokens,
+			ImageTokens: imageResponse.Usage.InputTokensDetails.ImageTokens,
+		},
+	}
 }
@@ -124,6 +124,10 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	// So the HTTPClient will be confused by the response.
 	// For example, Postman will report error, and we cannot check the response at all.
 	for k, v := range resp.Header {
+		if c.Writer.Header().Get(k) != "" {
+			// keep the headers set by One API, e.g. x-ratelimit-*
+			continue
+		}
 		c.Writer.Header().Set(k, v[0])
 	}
 	c.Writer.WriteHeader(resp.StatusCode)
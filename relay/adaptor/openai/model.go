@@ -119,7 +119,18 @@ type ImageData struct {
 type ImageResponse struct {
 	Created int64       `json:"created"`
 	Data    []ImageData `json:"data"`
-	//model.Usage `json:"usage"`
+	Usage   *ImageUsage `json:"usage,omitempty"`
+}
+
+// ImageUsage is only returned by token based image models, e.g. gpt-image-1
+type ImageUsage struct {
+	TotalTokens        int `json:"total_tokens"`
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	InputTokensDetails struct {
+		TextTokens  int `json:"text_tokens"`
+		ImageTokens int `json:"image_tokens"`
+	} `json:"input_tokens_details"`
 }
 
 type ChatCompletionsStreamResponseChoice struct {
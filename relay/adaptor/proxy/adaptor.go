@@ -73,6 +73,7 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 	req.Header.Del("Content-Length")
 	req.Header.Del("Accept-Encoding")
 	req.Header.Del("Connection")
+	req.Header.Del("X-OneAPI-Tags") // only meant for One API
 
 	// set authorization header
 	req.Header.Set("Authorization", meta.APIKey)
@@ -24,6 +24,7 @@ type Adaptor struct {
 
 // ConvertImageRequest implements adaptor.Adaptor.
 func (*Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	width, height, aspectRatio := convertImageSize(request.Size)
 	return DrawImageRequest{
 		Input: ImageInput{
 			Steps:           25,
@@ -32,9 +33,9 @@ func (*Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
 			Seed:            int(time.Now().UnixNano()),
 			SafetyTolerance: 5,
 			NImages:         1, // replicate will always return 1 image
-			Width:           1440,
-			Height:          1440,
-			AspectRatio:     "1:1",
+			Width:           width,
+			Height:          height,
+			AspectRatio:     aspectRatio,
 		},
 	}, nil
 }
@@ -9,6 +9,9 @@ import (
 	"image/png"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,6 +25,34 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+var supportedAspectRatios = []string{"1:1", "16:9", "2:3", "3:2", "4:5", "5:4", "9:16"}
+
+// convertImageSize converts an OpenAI image size to the width, height and
+// aspect ratio of flux, sizes flux can't draw fall back to 1440x1440.
+func convertImageSize(size string) (width int, height int, aspectRatio string) {
+	width, height, aspectRatio = 1440, 1440, "1:1"
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return
+	}
+	x, errW := strconv.Atoi(w)
+	y, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil || x < 256 || x > 1440 || y < 256 || y > 1440 {
+		return
+	}
+	// flux requires multiples of 32
+	width, height = x/32*32, y/32*32
+	a, b := x, y
+	for b != 0 {
+		a, b = b, a%b
+	}
+	aspectRatio = fmt.Sprintf("%d:%d", x/a, y/a)
+	if !slices.Contains(supportedAspectRatios, aspectRatio) {
+		aspectRatio = "custom"
+	}
+	return
+}
+
 // ImagesEditsHandler just copy response body to client
 //
 // https://replicate.com/black-forest-labs/flux-fill-pro
@@ -87,6 +87,7 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	newRequest := ImageRequest{
 		Model:  request.Model,
 		Prompt: request.Prompt,
+		Size:   request.Size,
 		UserId: request.User,
 	}
 	return newRequest, nil
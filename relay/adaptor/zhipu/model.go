@@ -66,5 +66,6 @@ type EmbeddingData struct {
 type ImageRequest struct {
 	Model  string `json:"model"`
 	Prompt string `json:"prompt"`
+	Size   string `json:"size,omitempty"`
 	UserId string `json:"user_id,omitempty"`
 }
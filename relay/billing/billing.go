@@ -12,7 +12,7 @@ func ReturnPreConsumedQuota(ctx context.Context, preConsumedQuota int64, tokenId
 	if preConsumedQuota != 0 {
 		go func(ctx context.Context) {
 			// return pre-consumed quota
-			err := model.PostConsumeTokenQuota(tokenId, -preConsumedQuota)
+			err := model.PostConsumeTokenQuota(ctx, tokenId, -preConsumedQuota)
 			if err != nil {
 				logger.Error(ctx, "error return pre-consumed quota: "+err.Error())
 			}
@@ -22,7 +22,7 @@ func ReturnPreConsumedQuota(ctx context.Context, preConsumedQuota int64, tokenId
 
 func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQuota int64, userId int, channelId int, modelRatio float64, groupRatio float64, modelName string, tokenName string) {
 	// quotaDelta is remaining quota to be consumed
-	err := model.PostConsumeTokenQuota(tokenId, quotaDelta)
+	err := model.PostConsumeTokenQuota(ctx, tokenId, quotaDelta)
 	if err != nil {
 		logger.SysError("error consuming token remain quota: " + err.Error())
 	}
@@ -40,6 +40,7 @@ func PostConsumeQuota(ctx context.Context, tokenId int, quotaDelta int64, totalQ
 			CompletionTokens: 0,
 			ModelName:        modelName,
 			TokenName:        tokenName,
+			TokenId:          tokenId,
 			Quota:            int(totalQuota),
 			Content:          logContent,
 		})
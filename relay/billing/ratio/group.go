@@ -2,6 +2,7 @@ package ratio
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/songquanpeng/one-api/common/logger"
 	"sync"
 )
@@ -38,3 +39,71 @@ func GetGroupRatio(name string) float64 {
 	}
 	return ratio
 }
+
+// GroupModelRatio overrides GroupRatio for specific models of a group,
+// e.g. {"vip": {"gpt-4o-mini": 0.5, "o1": 1, "*": 0.8}}, where "*" applies
+// to the models of the group that are not listed.
+var groupModelRatioLock sync.RWMutex
+var GroupModelRatio = map[string]map[string]float64{}
+
+func GroupModelRatio2JSONString() string {
+	jsonBytes, err := json.Marshal(GroupModelRatio)
+	if err != nil {
+		logger.SysError("error marshalling group model ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func parseGroupModelRatio(jsonStr string) (map[string]map[string]float64, error) {
+	groupModelRatio := make(map[string]map[string]float64)
+	if jsonStr == "" {
+		return groupModelRatio, nil
+	}
+	err := json.Unmarshal([]byte(jsonStr), &groupModelRatio)
+	if err != nil {
+		return nil, fmt.Errorf("group model ratio must be an object of group name to an object of model name to ratio: %s", err.Error())
+	}
+	for group, modelRatio := range groupModelRatio {
+		for model, ratio := range modelRatio {
+			if ratio < 0 {
+				return nil, fmt.Errorf("ratio of model %s in group %s is negative", model, group)
+			}
+		}
+	}
+	return groupModelRatio, nil
+}
+
+func ValidateGroupModelRatioJSONString(jsonStr string) error {
+	_, err := parseGroupModelRatio(jsonStr)
+	return err
+}
+
+func UpdateGroupModelRatioByJSONString(jsonStr string) error {
+	groupModelRatio, err := parseGroupModelRatio(jsonStr)
+	if err != nil {
+		return err
+	}
+	groupModelRatioLock.Lock()
+	defer groupModelRatioLock.Unlock()
+	GroupModelRatio = groupModelRatio
+	return nil
+}
+
+// GetGroupModelRatio is the multiplier a group pays for a model, falling back
+// to the "*" entry of the group and then to its GroupRatio.
+func GetGroupModelRatio(group string, model string) float64 {
+	groupModelRatioLock.RLock()
+	modelRatio, ok := GroupModelRatio[group]
+	if ok {
+		if ratio, ok := modelRatio[model]; ok {
+			groupModelRatioLock.RUnlock()
+			return ratio
+		}
+		if ratio, ok := modelRatio["*"]; ok {
+			groupModelRatioLock.RUnlock()
+			return ratio
+		}
+	}
+	groupModelRatioLock.RUnlock()
+	return GetGroupRatio(group)
+}
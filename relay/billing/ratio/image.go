@@ -1,45 +1,252 @@
 package ratio
 
-var ImageSizeRatios = map[string]map[string]float64{
+import "math"
+
+// ImagePrice describes how one image of a model is priced, the quota of an image
+// is modelRatio * groupRatio * 1000 * the cost ratio picked from the price.
+type ImagePrice struct {
+	// Sizes is the cost ratio of each supported size, nil accepts any size at ratio 1
+	Sizes map[string]float64
+	// Qualities replaces Sizes for each supported quality, nil accepts any quality
+	Qualities map[string]map[string]float64
+	// DefaultQuality is used when the request doesn't specify one
+	DefaultQuality string
+	// Styles multiplies the cost ratio for each supported style, nil accepts any style
+	Styles map[string]float64
+	// TokenBased models report their usage, the cost ratio is only an estimate
+	// used before the request, the final quota is computed from the tokens.
+	TokenBased bool
+	// ImageInputRatio is the price of image input tokens relative to text input tokens
+	ImageInputRatio float64
+}
+
+var ImagePrices = map[string]*ImagePrice{
 	"dall-e-2": {
-		"256x256":   1,
-		"512x512":   1.125,
-		"1024x1024": 1.25,
+		Sizes: map[string]float64{
+			"256x256":   1,
+			"512x512":   1.125,
+			"1024x1024": 1.25,
+		},
 	},
 	"dall-e-3": {
-		"1024x1024": 1,
-		"1024x1792": 2,
-		"1792x1024": 2,
+		Qualities: map[string]map[string]float64{
+			"standard": {
+				"1024x1024": 1,
+				"1024x1792": 2,
+				"1792x1024": 2,
+			},
+			"hd": {
+				"1024x1024": 2,
+				"1024x1792": 3,
+				"1792x1024": 3,
+			},
+		},
+		DefaultQuality: "standard",
+		Styles: map[string]float64{
+			"vivid":   1,
+			"natural": 1,
+		},
+	},
+	// https://platform.openai.com/docs/pricing#image-generation
+	// estimated with the model ratio of $5 / 1M text input tokens
+	"gpt-image-1": {
+		Qualities: map[string]map[string]float64{
+			"low": {
+				"1024x1024": 2.2, // $0.011 / image
+				"1024x1536": 3.2, // $0.016 / image
+				"1536x1024": 3.2, // $0.016 / image
+				"auto":      3.2, // the largest size
+			},
+			"medium": {
+				"1024x1024": 8.4,  // $0.042 / image
+				"1024x1536": 12.6, // $0.063 / image
+				"1536x1024": 12.6, // $0.063 / image
+				"auto":      12.6,
+			},
+			"high": {
+				"1024x1024": 33.4, // $0.167 / image
+				"1024x1536": 50,   // $0.25 / image
+				"1536x1024": 50,   // $0.25 / image
+				"auto":      50,
+			},
+			"auto": {
+				"1024x1024": 33.4, // the highest quality
+				"1024x1536": 50,
+				"1536x1024": 50,
+				"auto":      50,
+			},
+		},
+		DefaultQuality:  "auto",
+		TokenBased:      true,
+		ImageInputRatio: 2, // $10 / 1M image input tokens
 	},
 	"ali-stable-diffusion-xl": {
-		"512x1024":  1,
-		"1024x768":  1,
-		"1024x1024": 1,
-		"576x1024":  1,
-		"1024x576":  1,
+		Sizes: map[string]float64{
+			"512x1024":  1,
+			"1024x768":  1,
+			"1024x1024": 1,
+			"576x1024":  1,
+			"1024x576":  1,
+		},
 	},
 	"ali-stable-diffusion-v1.5": {
-		"512x1024":  1,
-		"1024x768":  1,
-		"1024x1024": 1,
-		"576x1024":  1,
-		"1024x576":  1,
+		Sizes: map[string]float64{
+			"512x1024":  1,
+			"1024x768":  1,
+			"1024x1024": 1,
+			"576x1024":  1,
+			"1024x576":  1,
+		},
 	},
 	"wanx-v1": {
-		"1024x1024": 1,
-		"720x1280":  1,
-		"1280x720":  1,
+		Sizes: map[string]float64{
+			"1024x1024": 1,
+			"720x1280":  1,
+			"1280x720":  1,
+		},
+		// passed as is to the style parameter
+		Styles: map[string]float64{
+			"<auto>":              1,
+			"<photography>":       1,
+			"<portrait>":          1,
+			"<3d cartoon>":        1,
+			"<anime>":             1,
+			"<oil painting>":      1,
+			"<watercolor>":        1,
+			"<sketch>":            1,
+			"<chinese painting>":  1,
+			"<flat illustration>": 1,
+		},
+	},
+	// https://cloud.baidu.com/doc/WENXINWORKSHOP/s/Klkqubb9w
+	"Stable-Diffusion-XL": {
+		Sizes: map[string]float64{
+			"768x768":   1,
+			"768x1024":  1,
+			"1024x768":  1,
+			"576x1024":  1,
+			"1024x576":  1,
+			"1024x1024": 1,
+			"1536x1536": 1,
+			"1152x2048": 1,
+			"2048x1152": 1,
+			"1536x2048": 1,
+			"2048x1536": 1,
+			"2048x2048": 1,
+		},
+		Styles: map[string]float64{
+			"Base":         1,
+			"3D Model":     1,
+			"Analog Film":  1,
+			"Anime":        1,
+			"Cinematic":    1,
+			"Comic Book":   1,
+			"Craft Clay":   1,
+			"Digital Art":  1,
+			"Enhance":      1,
+			"Fantasy Art":  1,
+			"Isometric":    1,
+			"Line Art":     1,
+			"Lowpoly":      1,
+			"Neonpunk":     1,
+			"Origami":      1,
+			"Photographic": 1,
+			"Pixel Art":    1,
+			"Texture":      1,
+		},
+	},
+	"cogview-3-plus": {
+		Sizes: map[string]float64{
+			"1024x1024": 1,
+			"768x1344":  1,
+			"864x1152":  1,
+			"1344x768":  1,
+			"1152x864":  1,
+			"1440x720":  1,
+			"720x1440":  1,
+		},
 	},
 	"step-1x-medium": {
-		"256x256":   1,
-		"512x512":   1,
-		"768x768":   1,
-		"1024x1024": 1,
-		"1280x800":  1,
-		"800x1280":  1,
+		Sizes: map[string]float64{
+			"256x256":   1,
+			"512x512":   1,
+			"768x768":   1,
+			"1024x1024": 1,
+			"1280x800":  1,
+			"800x1280":  1,
+		},
 	},
 }
 
+func GetImagePrice(model string) *ImagePrice {
+	return ImagePrices[model]
+}
+
+func (p *ImagePrice) sizes(quality string) map[string]float64 {
+	if quality == "" {
+		quality = p.DefaultQuality
+	}
+	if p.Qualities != nil {
+		return p.Qualities[quality]
+	}
+	return p.Sizes
+}
+
+func IsValidImageQuality(model string, quality string) bool {
+	price := GetImagePrice(model)
+	if price == nil || price.Qualities == nil || quality == "" {
+		return true
+	}
+	_, ok := price.Qualities[quality]
+	return ok
+}
+
+func IsValidImageSize(model string, size string, quality string) bool {
+	price := GetImagePrice(model)
+	if price == nil || (price.Qualities == nil && price.Sizes == nil) {
+		return true
+	}
+	_, ok := price.sizes(quality)[size]
+	return ok
+}
+
+func IsValidImageStyle(model string, style string) bool {
+	price := GetImagePrice(model)
+	if price == nil || price.Styles == nil || style == "" {
+		return true
+	}
+	_, ok := price.Styles[style]
+	return ok
+}
+
+// GetImageCostRatio returns the cost ratio of one image, unknown models,
+// sizes, qualities and styles cost 1.
+func GetImageCostRatio(model string, size string, quality string, style string) float64 {
+	price := GetImagePrice(model)
+	if price == nil {
+		return 1
+	}
+	costRatio := 1.0
+	if ratio, ok := price.sizes(quality)[size]; ok {
+		costRatio = ratio
+	}
+	if ratio, ok := price.Styles[style]; ok {
+		costRatio *= ratio
+	}
+	return costRatio
+}
+
+// GetImageTokenQuota computes the quota of a token based image model from the
+// usage reported by upstream, output tokens are priced with the completion ratio.
+func GetImageTokenQuota(model string, textInputTokens int, imageInputTokens int, outputTokens int, ratio float64, completionRatio float64) int64 {
+	imageInputRatio := 1.0
+	if price := GetImagePrice(model); price != nil && price.ImageInputRatio != 0 {
+		imageInputRatio = price.ImageInputRatio
+	}
+	tokens := float64(textInputTokens) + float64(imageInputTokens)*imageInputRatio + float64(outputTokens)*completionRatio
+	return int64(math.Ceil(tokens * ratio))
+}
+
 var ImageGenerationAmounts = map[string][2]int{
 	"dall-e-2":                  {1, 10},
 	"dall-e-3":                  {1, 1}, // OpenAI allows n=1 currently.
@@ -47,17 +254,22 @@ var ImageGenerationAmounts = map[string][2]int{
 	"ali-stable-diffusion-v1.5": {1, 4}, // Ali
 	"wanx-v1":                   {1, 4}, // Ali
 	"cogview-3":                 {1, 1},
+	"cogview-3-plus":            {1, 1},
+	"gpt-image-1":               {1, 10},
 	"step-1x-medium":            {1, 1},
+	"Stable-Diffusion-XL":       {1, 4}, // Baidu
 }
 
 var ImagePromptLengthLimitations = map[string]int{
 	"dall-e-2":                  1000,
 	"dall-e-3":                  4000,
+	"gpt-image-1":               32000,
 	"ali-stable-diffusion-xl":   4000,
 	"ali-stable-diffusion-v1.5": 4000,
 	"wanx-v1":                   4000,
 	"cogview-3":                 833,
 	"step-1x-medium":            4000,
+	"Stable-Diffusion-XL":       1024,
 }
 
 var ImageOriginModelName = map[string]string{
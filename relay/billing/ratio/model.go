@@ -87,6 +87,7 @@ var ModelRatio = map[string]float64{
 	"text-moderation-latest":  0.1,
 	"dall-e-2":                0.02 * USD, // $0.016 - $0.020 / image
 	"dall-e-3":                0.04 * USD, // $0.040 - $0.120 / image
+	"gpt-image-1":             2.5,        // $0.005 / 1K text input tokens, see ImagePrices
 	// https://docs.anthropic.com/en/docs/about-claude/models
 	"claude-instant-1.2":         0.8 / 1000 * USD,
 	"claude-2.0":                 8.0 / 1000 * USD,
@@ -116,6 +117,10 @@ var ModelRatio = map[string]float64{
 	"bge-large-zh":       0.002 * RMB,
 	"bge-large-en":       0.002 * RMB,
 	"tao-8k":             0.002 * RMB,
+
+	// https://cloud.baidu.com/doc/WENXINWORKSHOP/s/Klkqubb9w, per image
+	"Stable-Diffusion-XL": 0.06 * RMB,
+
 	// https://ai.google.dev/pricing
 	// https://cloud.google.com/vertex-ai/generative-ai/pricing
 	// "gemma-2-2b-it":                       0,
@@ -627,6 +632,8 @@ var CompletionRatio = map[string]float64{
 	"llama3-70b-8192(33)": 0.0035 / 0.00265,
 	// whisper
 	"whisper-1": 0, // only count input tokens
+	// gpt-image-1 image output tokens, $40 / 1M
+	"gpt-image-1": 8,
 	// deepseek
 	"deepseek-chat":     0.28 / 0.14,
 	"deepseek-reasoner": 2.19 / 0.55,
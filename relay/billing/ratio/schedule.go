@@ -0,0 +1,156 @@
+package ratio
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// PriceWindow applies Multiplier from Start to End ("15:04"), windows ending
+// before they start wrap around midnight.
+type PriceWindow struct {
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Multiplier float64 `json:"multiplier"`
+	start      int     // minutes since midnight
+	end        int
+}
+
+// PriceSchedule is the time-of-day pricing of a model, e.g.
+// {"deepseek-chat": {"timezone": "Asia/Shanghai", "windows": [{"start": "00:30", "end": "08:30", "multiplier": 0.5}]}}
+// Outside of the windows the multiplier is 1, the first matching window wins.
+type PriceSchedule struct {
+	Timezone string        `json:"timezone"`
+	Windows  []PriceWindow `json:"windows"`
+	location *time.Location
+}
+
+var modelPriceScheduleLock sync.RWMutex
+var ModelPriceSchedule = map[string]*PriceSchedule{}
+
+func ModelPriceSchedule2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelPriceSchedule)
+	if err != nil {
+		logger.SysError("error marshalling model price schedule: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func parseMinuteOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseModelPriceSchedule(jsonStr string) (map[string]*PriceSchedule, error) {
+	schedules := make(map[string]*PriceSchedule)
+	if jsonStr == "" {
+		return schedules, nil
+	}
+	err := json.Unmarshal([]byte(jsonStr), &schedules)
+	if err != nil {
+		return nil, fmt.Errorf("model price schedule must be an object of model name to schedule: %s", err.Error())
+	}
+	for model, schedule := range schedules {
+		if schedule == nil {
+			return nil, fmt.Errorf("price schedule of model %s is empty", model)
+		}
+		schedule.location, err = time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone of model %s: %s", model, err.Error())
+		}
+		for i := range schedule.Windows {
+			window := &schedule.Windows[i]
+			if window.start, err = parseMinuteOfDay(window.Start); err != nil {
+				return nil, fmt.Errorf("price schedule of model %s: %s", model, err.Error())
+			}
+			if window.end, err = parseMinuteOfDay(window.End); err != nil {
+				return nil, fmt.Errorf("price schedule of model %s: %s", model, err.Error())
+			}
+			if window.start == window.end {
+				return nil, fmt.Errorf("price window %s-%s of model %s is empty", window.Start, window.End, model)
+			}
+			if window.Multiplier < 0 {
+				return nil, fmt.Errorf("price multiplier of model %s is negative", model)
+			}
+		}
+	}
+	return schedules, nil
+}
+
+func ValidateModelPriceScheduleJSONString(jsonStr string) error {
+	_, err := parseModelPriceSchedule(jsonStr)
+	return err
+}
+
+func UpdateModelPriceScheduleByJSONString(jsonStr string) error {
+	schedules, err := parseModelPriceSchedule(jsonStr)
+	if err != nil {
+		return err
+	}
+	modelPriceScheduleLock.Lock()
+	defer modelPriceScheduleLock.Unlock()
+	ModelPriceSchedule = schedules
+	return nil
+}
+
+func (schedule *PriceSchedule) multiplierAt(t time.Time) float64 {
+	t = t.In(schedule.location)
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range schedule.Windows {
+		if window.start < window.end {
+			if minute >= window.start && minute < window.end {
+				return window.Multiplier
+			}
+		} else if minute >= window.start || minute < window.end {
+			return window.Multiplier
+		}
+	}
+	return 1
+}
+
+func getPriceSchedule(model string) *PriceSchedule {
+	modelPriceScheduleLock.RLock()
+	defer modelPriceScheduleLock.RUnlock()
+	return ModelPriceSchedule[model]
+}
+
+// GetPriceMultiplier is the time-of-day multiplier of a model for a request started at t.
+func GetPriceMultiplier(model string, t time.Time) float64 {
+	schedule := getPriceSchedule(model)
+	if schedule == nil {
+		return 1
+	}
+	return schedule.multiplierAt(t)
+}
+
+// GetNextPriceChange returns when the multiplier of a model changes after t
+// and the multiplier from then on, ok is false if it never changes.
+func GetNextPriceChange(model string, t time.Time) (next time.Time, multiplier float64, ok bool) {
+	schedule := getPriceSchedule(model)
+	if schedule == nil {
+		return next, 1, false
+	}
+	current := schedule.multiplierAt(t)
+	local := t.In(schedule.location)
+	// every window boundary happens within the next day
+	for day := 0; day <= 1; day++ {
+		for _, window := range schedule.Windows {
+			for _, minute := range []int{window.start, window.end} {
+				boundary := time.Date(local.Year(), local.Month(), local.Day()+day, minute/60, minute%60, 0, 0, schedule.location)
+				if !boundary.After(t) || (ok && !boundary.Before(next)) {
+					continue
+				}
+				if m := schedule.multiplierAt(boundary); m != current {
+					next, multiplier, ok = boundary, m, true
+				}
+			}
+		}
+	}
+	return next, multiplier, ok
+}
@@ -0,0 +1,92 @@
+package ratio
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPriceSchedule(t *testing.T) {
+	defer func(schedules map[string]*PriceSchedule) { ModelPriceSchedule = schedules }(ModelPriceSchedule)
+	err := UpdateModelPriceScheduleByJSONString(`{
+		"night": {"timezone": "UTC", "windows": [{"start": "22:00", "end": "06:00", "multiplier": 0.5}, {"start": "12:00", "end": "13:00", "multiplier": 2}]},
+		"flat": {"timezone": "UTC", "windows": [{"start": "00:00", "end": "12:00", "multiplier": 1}, {"start": "12:00", "end": "00:00", "multiplier": 1}]}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	Convey("GetPriceMultiplier", t, func() {
+		tests := []struct {
+			model string
+			t     time.Time
+			want  float64
+		}{
+			{"night", at(10, 23, 0), 0.5},
+			{"night", at(10, 22, 0), 0.5},
+			{"night", at(10, 3, 0), 0.5},
+			{"night", at(10, 5, 59), 0.5},
+			{"night", at(10, 6, 0), 1},
+			{"night", at(10, 21, 59), 1},
+			{"night", at(10, 12, 30), 2},
+			{"night", at(10, 13, 0), 1},
+			{"unknown", at(10, 23, 0), 1},
+		}
+		for _, tt := range tests {
+			So(GetPriceMultiplier(tt.model, tt.t), ShouldEqual, tt.want)
+		}
+	})
+	Convey("GetNextPriceChange", t, func() {
+		tests := []struct {
+			name       string
+			model      string
+			t          time.Time
+			next       time.Time
+			multiplier float64
+			ok         bool
+		}{
+			{"before a window", "night", at(10, 10, 0), at(10, 12, 0), 2, true},
+			{"in a window", "night", at(10, 12, 30), at(10, 13, 0), 1, true},
+			{"before a window wrapping midnight", "night", at(10, 14, 0), at(10, 22, 0), 0.5, true},
+			{"in a window wrapping midnight, before midnight", "night", at(10, 23, 0), at(11, 6, 0), 1, true},
+			{"in a window wrapping midnight, after midnight", "night", at(11, 3, 0), at(11, 6, 0), 1, true},
+			{"at a boundary", "night", at(10, 22, 0), at(11, 6, 0), 1, true},
+			{"never changes", "flat", at(10, 10, 0), time.Time{}, 0, false},
+		}
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				next, multiplier, ok := GetNextPriceChange(tt.model, tt.t)
+				So(ok, ShouldEqual, tt.ok)
+				if tt.ok {
+					So(next, ShouldEqual, tt.next)
+					So(multiplier, ShouldEqual, tt.multiplier)
+				}
+			})
+		}
+		Convey("unknown model", func() {
+			_, multiplier, ok := GetNextPriceChange("unknown", at(10, 10, 0))
+			So(ok, ShouldBeFalse)
+			So(multiplier, ShouldEqual, 1)
+		})
+	})
+	Convey("validation", t, func() {
+		tests := []struct {
+			json  string
+			valid bool
+		}{
+			{``, true},
+			{`{"m": {"timezone": "UTC", "windows": [{"start": "25:00", "end": "06:00", "multiplier": 0.5}]}}`, false},
+			{`{"m": {"timezone": "UTC", "windows": [{"start": "06:00", "end": "06:00", "multiplier": 0.5}]}}`, false},
+			{`{"m": {"timezone": "UTC", "windows": [{"start": "00:00", "end": "06:00", "multiplier": -1}]}}`, false},
+			{`{"m": {"timezone": "Nowhere/Nothing", "windows": []}}`, false},
+			{`{"m": null}`, false},
+		}
+		for _, tt := range tests {
+			So(ValidateModelPriceScheduleJSONString(tt.json) == nil, ShouldEqual, tt.valid)
+		}
+	})
+}
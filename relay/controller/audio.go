@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"strings"
 
@@ -40,22 +41,31 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	tokenName := c.GetString(ctxkey.TokenName)
 
 	var ttsRequest openai.TextToSpeechRequest
-	if relayMode == relaymode.AudioSpeech {
+	// the model of the request, the token and the channel may map it to another one
+	var requestModel string
+	if relayMode != relaymode.AudioSpeech {
+		requestModel = c.PostForm("model")
+	} else {
 		// Read JSON
 		err := common.UnmarshalBodyReusable(c, &ttsRequest)
 		// Check if JSON is valid
 		if err != nil {
 			return openai.ErrorWrapper(err, "invalid_json", http.StatusBadRequest)
 		}
-		audioModel = ttsRequest.Model
+		requestModel = ttsRequest.Model
 		// Check if text is too long 4096
 		if len(ttsRequest.Input) > 4096 {
 			return openai.ErrorWrapper(errors.New("input is too long (over 4096 characters)"), "text_too_long", http.StatusBadRequest)
 		}
 	}
 
+	upstreamModel, _ := getMappedModelName(requestModel, meta.TokenModelMapping)
+	if relayMode == relaymode.AudioSpeech {
+		audioModel = upstreamModel
+	}
+
 	modelRatio := billingratio.GetModelRatio(audioModel, channelType)
-	groupRatio := billingratio.GetGroupRatio(group)
+	groupRatio := billingratio.GetGroupModelRatio(group, audioModel)
 	ratio := modelRatio * groupRatio
 	var quota int64
 	var preConsumedQuota int64
@@ -66,6 +76,9 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	default:
 		preConsumedQuota = int64(float64(config.PreConsumedQuota) * ratio)
 	}
+	// read the remaining quotas before they are pre-consumed
+	costReport := newCostReport(c, meta)
+	defer costReport.Flush()
 	userQuota, err := model.CacheGetUserQuota(ctx, userId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
@@ -81,11 +94,14 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 	if userQuota > 100*preConsumedQuota {
 		// in this case, we do not pre-consume quota
-		// because the user has enough quota
+		// because the user has enough quota, but the budget of the token still applies
+		if err := model.CheckTokenBudget(tokenId, preConsumedQuota); err != nil {
+			return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+		}
 		preConsumedQuota = 0
 	}
 	if preConsumedQuota > 0 {
-		err := model.PreConsumeTokenQuota(tokenId, preConsumedQuota)
+		err := model.PreConsumeTokenQuota(ctx, tokenId, preConsumedQuota)
 		if err != nil {
 			return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
@@ -100,7 +116,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			defer func(ctx context.Context) {
 				go func() {
 					// negative means add quota back for token & user
-					err := model.PostConsumeTokenQuota(tokenId, -preConsumedQuota)
+					err := model.PostConsumeTokenQuota(ctx, tokenId, -preConsumedQuota)
 					if err != nil {
 						logger.Error(ctx, fmt.Sprintf("error rollback pre-consumed quota: %s", err.Error()))
 					}
@@ -114,6 +130,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	if modelMapping != nil && modelMapping[audioModel] != "" {
 		audioModel = modelMapping[audioModel]
 	}
+	upstreamModel, _ = getMappedModelName(upstreamModel, modelMapping)
 
 	baseURL := channeltype.ChannelBaseURLs[channelType]
 	requestURL := c.Request.URL.String()
@@ -140,6 +157,13 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody.Bytes()))
 	responseFormat := c.DefaultPostForm("response_format", "json")
+	contentType := c.Request.Header.Get("Content-Type")
+	if requestModel != "" && upstreamModel != requestModel {
+		requestBody, contentType, err = setAudioRequestModel(c, relayMode, requestBody.Bytes(), upstreamModel)
+		if err != nil {
+			return openai.ErrorWrapper(err, "set_request_model_failed", http.StatusInternalServerError)
+		}
+	}
 
 	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
@@ -151,11 +175,11 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		apiKey := c.Request.Header.Get("Authorization")
 		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
 		req.Header.Set("api-key", apiKey)
-		req.ContentLength = c.Request.ContentLength
+		req.ContentLength = int64(requestBody.Len())
 	} else {
 		req.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
 	}
-	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
 
 	resp, err := client.HTTPClient.Do(req)
@@ -218,8 +242,14 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	defer func(ctx context.Context) {
 		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
 	}(c.Request.Context())
+	// sets the cost headers, the response is written below
+	costReport.Report(quota, audioModel)
 
 	for k, v := range resp.Header {
+		if c.Writer.Header().Get(k) != "" {
+			// keep the headers set by One API, e.g. x-ratelimit-*
+			continue
+		}
 		c.Writer.Header().Set(k, v[0])
 	}
 	c.Writer.WriteHeader(resp.StatusCode)
@@ -235,6 +265,59 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	return nil
 }
 
+// setAudioRequestModel rewrites the body of an audio request with another model,
+// speech requests are JSON and the others multipart forms.
+func setAudioRequestModel(c *gin.Context, relayMode int, body []byte, model string) (*bytes.Buffer, string, error) {
+	contentType := c.Request.Header.Get("Content-Type")
+	if relayMode == relaymode.AudioSpeech {
+		request := make(map[string]any)
+		err := json.Unmarshal(body, &request)
+		if err != nil {
+			return nil, "", err
+		}
+		request["model"] = model
+		body, err = json.Marshal(request)
+		return bytes.NewBuffer(body), contentType, err
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, "", err
+	}
+	buffer := &bytes.Buffer{}
+	writer := multipart.NewWriter(buffer)
+	for key, values := range form.Value {
+		for _, value := range values {
+			if key == "model" {
+				value = model
+			}
+			if err = writer.WriteField(key, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	for _, files := range form.File {
+		for _, file := range files {
+			part, err := writer.CreatePart(file.Header)
+			if err != nil {
+				return nil, "", err
+			}
+			src, err := file.Open()
+			if err != nil {
+				return nil, "", err
+			}
+			_, err = io.Copy(part, src)
+			src.Close()
+			if err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buffer, writer.FormDataContentType(), nil
+}
+
 func getTextFromVTT(body []byte) (string, error) {
 	return getTextFromSRT(body)
 }
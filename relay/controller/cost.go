@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+const (
+	costQuotaHeader         = "X-Oneapi-Quota"
+	costTokenRemainHeader   = "X-Oneapi-Token-Remain-Quota"
+	costUserRemainHeader    = "X-Oneapi-User-Remain-Quota"
+	costModelHeader         = "X-Oneapi-Model"
+	costChannelTypeHeader   = "X-Oneapi-Channel-Type"
+	costChannelIdHeader     = "X-Oneapi-Channel-Id" // admins only
+	costStreamCommentPrefix = ": oneapi-cost "
+)
+
+// Cost is what a relayed request was charged, reported to tokens with CostHeaders on.
+// The remaining quotas are left out if they can't be read.
+type Cost struct {
+	Quota            int64  `json:"quota"`
+	TokenRemainQuota *int64 `json:"token_remain_quota,omitempty"` // -1 means unlimited
+	UserRemainQuota  *int64 `json:"user_remain_quota,omitempty"`
+	Model            string `json:"model"`
+	ChannelType      int    `json:"channel_type"`
+	ChannelId        int    `json:"channel_id,omitempty"`
+}
+
+// costWriter holds back a non-stream response, so that the cost headers can
+// be set once the request is billed.
+type costWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *costWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *costWriter) WriteHeaderNow() {}
+
+func (w *costWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *costWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *costWriter) Status() int {
+	return w.status
+}
+
+func (w *costWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *costWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *costWriter) Flush() {}
+
+// streamCostWriter holds back the [DONE] event of a stream, so that the cost
+// comment is written before it, most clients stop reading at [DONE].
+type streamCostWriter struct {
+	gin.ResponseWriter
+	done []byte
+}
+
+var streamDoneEvent = []byte("data: [DONE]")
+
+func (w *streamCostWriter) Write(data []byte) (int, error) {
+	if w.done != nil || bytes.HasPrefix(data, streamDoneEvent) {
+		w.done = append(w.done, data...)
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *streamCostWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// costReport is nil unless the token has CostHeaders on, all methods are safe on nil.
+// It is created before the request is billed, the remaining quotas are reported
+// as the ones read then minus the charge, the billing may be batched or still running.
+type costReport struct {
+	c                *gin.Context
+	meta             *meta.Meta
+	writer           *costWriter
+	streamWriter     *streamCostWriter
+	flushed          bool
+	tokenRemainQuota *int64 // -1 means unlimited
+	userRemainQuota  *int64
+}
+
+func newCostReport(c *gin.Context, meta *meta.Meta) *costReport {
+	if !c.GetBool(ctxkey.CostHeaders) {
+		return nil
+	}
+	report := &costReport{c: c, meta: meta}
+	ctx := c.Request.Context()
+	token, err := model.GetTokenById(meta.TokenId)
+	if err != nil {
+		logger.Error(ctx, "error getting token for cost report: "+err.Error())
+	} else {
+		tokenRemainQuota := token.RemainQuota
+		if token.UnlimitedQuota {
+			tokenRemainQuota = -1
+		}
+		report.tokenRemainQuota = &tokenRemainQuota
+	}
+	userQuota, err := model.GetUserQuota(meta.UserId)
+	if err != nil {
+		logger.Error(ctx, "error getting user quota for cost report: "+err.Error())
+	} else {
+		report.userRemainQuota = &userQuota
+	}
+	if meta.IsStream {
+		report.streamWriter = &streamCostWriter{ResponseWriter: c.Writer}
+		c.Writer = report.streamWriter
+	} else {
+		report.writer = &costWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = report.writer
+	}
+	return report
+}
+
+func (r *costReport) getCost(quota int64, modelName string) *Cost {
+	cost := &Cost{
+		Quota:       quota,
+		Model:       modelName,
+		ChannelType: r.meta.ChannelType,
+	}
+	if r.tokenRemainQuota != nil {
+		tokenRemainQuota := *r.tokenRemainQuota
+		if tokenRemainQuota != -1 {
+			tokenRemainQuota -= quota
+		}
+		cost.TokenRemainQuota = &tokenRemainQuota
+	}
+	if r.userRemainQuota != nil {
+		userRemainQuota := *r.userRemainQuota - quota
+		cost.UserRemainQuota = &userRemainQuota
+	}
+	// channels are not visible to normal users
+	if model.IsAdmin(r.meta.UserId) {
+		cost.ChannelId = r.meta.ChannelId
+	}
+	return cost
+}
+
+// Report sends the cost as response headers, or as an SSE comment before the
+// [DONE] event for streams, since their headers are sent before the usage is known.
+func (r *costReport) Report(quota int64, modelName string) {
+	if r == nil || r.flushed {
+		return
+	}
+	cost := r.getCost(quota, modelName)
+	if r.streamWriter != nil {
+		jsonData, err := json.Marshal(cost)
+		if err != nil {
+			logger.Error(r.c.Request.Context(), "error marshalling cost: "+err.Error())
+			r.Flush()
+			return
+		}
+		_, _ = r.streamWriter.ResponseWriter.WriteString(costStreamCommentPrefix + string(jsonData) + "\n\n")
+		r.streamWriter.ResponseWriter.Flush()
+		r.Flush()
+		return
+	}
+	header := r.writer.Header()
+	header.Set(costQuotaHeader, strconv.FormatInt(cost.Quota, 10))
+	if cost.TokenRemainQuota != nil {
+		header.Set(costTokenRemainHeader, strconv.FormatInt(*cost.TokenRemainQuota, 10))
+	}
+	if cost.UserRemainQuota != nil {
+		header.Set(costUserRemainHeader, strconv.FormatInt(*cost.UserRemainQuota, 10))
+	}
+	header.Set(costModelHeader, cost.Model)
+	header.Set(costChannelTypeHeader, strconv.Itoa(cost.ChannelType))
+	if cost.ChannelId != 0 {
+		header.Set(costChannelIdHeader, strconv.Itoa(cost.ChannelId))
+	} else {
+		header.Del(costChannelIdHeader)
+	}
+	r.Flush()
+}
+
+// Flush sends the held back response as is, it has to be called on every path
+// once the adaptor is done with the response.
+func (r *costReport) Flush() {
+	if r == nil || r.flushed {
+		return
+	}
+	r.flushed = true
+	if r.streamWriter != nil {
+		r.c.Writer = r.streamWriter.ResponseWriter
+		if r.streamWriter.done == nil {
+			return
+		}
+		_, err := r.c.Writer.Write(r.streamWriter.done)
+		if err != nil {
+			logger.Error(r.c.Request.Context(), fmt.Sprintf("error writing response: %s", err.Error()))
+		}
+		r.c.Writer.Flush()
+		return
+	}
+	r.c.Writer = r.writer.ResponseWriter
+	if r.writer.body.Len() == 0 && !r.writer.ResponseWriter.Written() {
+		// nothing was written, the caller is going to respond itself
+		return
+	}
+	r.writer.ResponseWriter.WriteHeader(r.writer.status)
+	_, err := r.writer.ResponseWriter.Write(r.writer.body.Bytes())
+	if err != nil {
+		logger.Error(r.c.Request.Context(), fmt.Sprintf("error writing response: %s", err.Error()))
+	}
+}
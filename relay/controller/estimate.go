@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// Estimate is what a request would cost if it was relayed now. Quota is the
+// worst case: all of max_tokens are generated, or all of n images.
+type Estimate struct {
+	Object          string  `json:"object"`
+	Type            string  `json:"type"`
+	Model           string  `json:"model"`
+	ActualModel     string  `json:"actual_model"`
+	PromptTokens    int     `json:"prompt_tokens"`
+	MaxTokens       int     `json:"max_tokens"`
+	Unbounded       bool    `json:"unbounded"` // max_tokens is not set, so only the prompt is counted
+	ModelRatio      float64 `json:"model_ratio"`
+	GroupRatio      float64 `json:"group_ratio"`
+	CompletionRatio float64 `json:"completion_ratio"`
+	PriceMultiplier float64 `json:"price_multiplier"`
+	ImageCostRatio  float64 `json:"image_cost_ratio,omitempty"`
+	Quota           int64   `json:"quota"`
+	PreConsumeQuota int64   `json:"pre_consume_quota"` // held by the relay before the request, enough_quota also covers it
+	Amount          float64 `json:"amount"`            // quota in Currency, or quota itself if DisplayInCurrencyEnabled is off
+	Currency        string  `json:"currency"`          // the display currency of the user
+	UserQuota       int64   `json:"user_quota"`
+	TokenQuota      int64   `json:"token_quota"` // -1 means unlimited
+	EnoughQuota     bool    `json:"enough_quota"`
+}
+
+var estimateTypes = map[string]int{
+	"chat":        relaymode.ChatCompletions,
+	"completions": relaymode.Completions,
+	"embeddings":  relaymode.Embeddings,
+	"moderations": relaymode.Moderations,
+	"images":      relaymode.ImagesGenerations,
+}
+
+type estimateProbe struct {
+	Model    string          `json:"model"`
+	Messages json.RawMessage `json:"messages"`
+	Input    json.RawMessage `json:"input"`
+	Size     string          `json:"size"`
+}
+
+// getEstimateType uses the type query parameter, or guesses the type from the body.
+func getEstimateType(c *gin.Context) (string, error) {
+	if estimateType := c.Query("type"); estimateType != "" {
+		if _, ok := estimateTypes[estimateType]; !ok {
+			return "", errors.New("type must be one of chat, completions, embeddings, moderations and images")
+		}
+		return estimateType, nil
+	}
+	var probe estimateProbe
+	err := common.UnmarshalBodyReusable(c, &probe)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(probe.Messages) != 0:
+		return "chat", nil
+	case len(probe.Input) != 0:
+		return "embeddings", nil
+	case probe.Size != "" || billingratio.GetImagePrice(probe.Model) != nil:
+		return "images", nil
+	}
+	if _, ok := billingratio.ImageGenerationAmounts[probe.Model]; ok {
+		return "images", nil
+	}
+	return "completions", nil
+}
+
+// EstimateHelper runs the validation, model mapping and billing of the relay
+// for a request without sending it upstream.
+func EstimateHelper(c *gin.Context) (*Estimate, *relaymodel.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	estimateType, err := getEstimateType(c)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "invalid_estimate_request", http.StatusBadRequest)
+	}
+	meta.Mode = estimateTypes[estimateType]
+	estimate := &Estimate{
+		Object: "oneapi.estimate",
+		Type:   estimateType,
+	}
+	if meta.Mode == relaymode.ImagesGenerations {
+		bizErr := estimateImageRequest(c, meta, estimate)
+		if bizErr != nil {
+			return nil, bizErr
+		}
+	} else {
+		textRequest, err := getAndValidateTextRequest(c, meta.Mode)
+		if err != nil {
+			return nil, openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+		}
+		estimate.Model = textRequest.Model
+		textRequest.Model, _ = getMappedModelName(textRequest.Model, meta.TokenModelMapping)
+		textRequest.Model, _ = getMappedModelName(textRequest.Model, meta.ModelMapping)
+		estimate.ActualModel = textRequest.Model
+		setSystemPrompts(ctx, textRequest, meta)
+		estimate.ModelRatio = billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
+		estimate.GroupRatio = billingratio.GetGroupModelRatio(meta.Group, textRequest.Model)
+		estimate.CompletionRatio = billingratio.GetCompletionRatio(textRequest.Model, meta.ChannelType)
+		estimate.PriceMultiplier = billingratio.GetPriceMultiplier(textRequest.Model, meta.StartTime)
+		if meta.Mode == relaymode.Embeddings {
+			// the relay bills embeddings by the usage returned, so they are counted here only
+			estimate.PromptTokens = openai.CountTokenInput(textRequest.Input, textRequest.Model)
+		} else {
+			estimate.PromptTokens = getPromptTokens(textRequest, meta.Mode)
+		}
+		switch meta.Mode {
+		case relaymode.ChatCompletions, relaymode.Completions:
+			estimate.MaxTokens = textRequest.MaxTokens
+			if textRequest.MaxCompletionTokens != nil {
+				estimate.MaxTokens = *textRequest.MaxCompletionTokens
+			}
+			estimate.Unbounded = estimate.MaxTokens == 0
+		}
+		ratio := estimate.ModelRatio * estimate.GroupRatio * estimate.PriceMultiplier
+		tokens := float64(estimate.PromptTokens) + float64(estimate.MaxTokens)*estimate.CompletionRatio
+		estimate.Quota = int64(math.Ceil(tokens * ratio))
+		estimate.PreConsumeQuota = getPreConsumedQuota(textRequest, estimate.PromptTokens, estimate.ModelRatio*estimate.GroupRatio)
+	}
+
+	currency, err := model.GetUserDisplayCurrency(meta.UserId)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "get_user_currency_failed", http.StatusInternalServerError)
+	}
+	estimate.Currency, _ = common.GetCurrency(currency)
+	estimate.Amount = common.QuotaToCurrency(estimate.Quota, estimate.Currency)
+
+	estimate.UserQuota, err = model.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	token, err := model.GetTokenByIds(meta.TokenId, meta.UserId)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "get_token_failed", http.StatusInternalServerError)
+	}
+	estimate.TokenQuota = token.RemainQuota
+	if token.UnlimitedQuota {
+		estimate.TokenQuota = -1
+	}
+	if token.HasBudget() && (token.UnlimitedQuota || token.PeriodRemainQuota() < token.RemainQuota) {
+		estimate.TokenQuota = token.PeriodRemainQuota()
+	}
+	required := estimate.Quota
+	if estimate.PreConsumeQuota > required {
+		required = estimate.PreConsumeQuota
+	}
+	estimate.EnoughQuota = estimate.UserQuota >= required &&
+		(estimate.TokenQuota == -1 || estimate.TokenQuota >= required)
+	return estimate, nil
+}
+
+func estimateImageRequest(c *gin.Context, meta *meta.Meta, estimate *Estimate) *relaymodel.ErrorWithStatusCode {
+	imageRequest, err := getImageRequest(c, meta.Mode)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_image_request", http.StatusBadRequest)
+	}
+	estimate.Model = imageRequest.Model
+	imageRequest.Model, _ = getMappedModelName(imageRequest.Model, meta.TokenModelMapping)
+	imageRequest.Model, _ = getMappedModelName(imageRequest.Model, meta.ModelMapping)
+	estimate.ActualModel = imageRequest.Model
+	bizErr := validateImageRequest(imageRequest, meta)
+	if bizErr != nil {
+		return bizErr
+	}
+	estimate.ImageCostRatio, err = getImageCostRatio(imageRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_image_cost_ratio_failed", http.StatusInternalServerError)
+	}
+	estimate.ModelRatio = billingratio.GetModelRatio(imageRequest.Model, meta.ChannelType)
+	estimate.GroupRatio = billingratio.GetGroupModelRatio(meta.Group, imageRequest.Model)
+	estimate.PriceMultiplier = 1
+	estimate.Quota = getImageQuota(meta.ChannelType, estimate.ModelRatio*estimate.GroupRatio, estimate.ImageCostRatio, imageRequest.N)
+	return nil
+}
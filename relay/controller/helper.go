@@ -81,12 +81,15 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 	}
 	if userQuota > 100*preConsumedQuota {
 		// in this case, we do not pre-consume quota
-		// because the user has enough quota
+		// because the user has enough quota, but the budget of the token still applies
+		if err := model.CheckTokenBudget(meta.TokenId, preConsumedQuota); err != nil {
+			return preConsumedQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+		}
 		preConsumedQuota = 0
 		logger.Info(ctx, fmt.Sprintf("user %d has enough quota %d, trusted and no need to pre-consume", meta.UserId, userQuota))
 	}
 	if preConsumedQuota > 0 {
-		err := model.PreConsumeTokenQuota(meta.TokenId, preConsumedQuota)
+		err := model.PreConsumeTokenQuota(ctx, meta.TokenId, preConsumedQuota)
 		if err != nil {
 			return preConsumedQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
@@ -94,16 +97,16 @@ func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIR
 	return preConsumedQuota, nil
 }
 
-func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, systemPromptReset bool) {
+// getTextQuota returns what a text request is charged for its usage.
+func getTextQuota(usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64) (quota int64, completionRatio float64, priceMultiplier float64) {
+	completionRatio = billingratio.GetCompletionRatio(textRequest.Model, meta.ChannelType)
+	priceMultiplier = billingratio.GetPriceMultiplier(textRequest.Model, meta.StartTime)
 	if usage == nil {
-		logger.Error(ctx, "usage is nil, which is unexpected")
-		return
+		return 0, completionRatio, priceMultiplier
 	}
-	var quota int64
-	completionRatio := billingratio.GetCompletionRatio(textRequest.Model, meta.ChannelType)
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
-	quota = int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
+	quota = int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio * priceMultiplier))
 	if ratio != 0 && quota <= 0 {
 		quota = 1
 	}
@@ -113,8 +116,19 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		// we cannot just return, because we may have to return the pre-consumed quota
 		quota = 0
 	}
+	return quota, completionRatio, priceMultiplier
+}
+
+func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, systemPromptReset bool) int64 {
+	if usage == nil {
+		logger.Error(ctx, "usage is nil, which is unexpected")
+		return 0
+	}
+	quota, completionRatio, priceMultiplier := getTextQuota(usage, meta, textRequest, ratio)
+	promptTokens := usage.PromptTokens
+	completionTokens := usage.CompletionTokens
 	quotaDelta := quota - preConsumedQuota
-	err := model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
+	err := model.PostConsumeTokenQuota(ctx, meta.TokenId, quotaDelta)
 	if err != nil {
 		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
 	}
@@ -123,6 +137,9 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
 	logContent := fmt.Sprintf("倍率：%.2f × %.2f × %.2f", modelRatio, groupRatio, completionRatio)
+	if priceMultiplier != 1 {
+		logContent += fmt.Sprintf("，时段倍率 %.2f", priceMultiplier)
+	}
 	model.RecordConsumeLog(ctx, &model.Log{
 		UserId:            meta.UserId,
 		ChannelId:         meta.ChannelId,
@@ -130,6 +147,7 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		CompletionTokens:  completionTokens,
 		ModelName:         textRequest.Model,
 		TokenName:         meta.TokenName,
+		TokenId:           meta.TokenId,
 		Quota:             int(quota),
 		Content:           logContent,
 		IsStream:          meta.IsStream,
@@ -138,6 +156,7 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	})
 	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+	return quota
 }
 
 func getMappedModelName(modelName string, mapping map[string]string) (string, bool) {
@@ -196,3 +215,28 @@ func setSystemPrompt(ctx context.Context, request *relaymodel.GeneralOpenAIReque
 	logger.Infof(ctx, "add system prompt")
 	return true
 }
+
+// setSystemPrompts applies the system prompt of the channel and then the one
+// of the token, so the token's prompt replaces or goes before the channel's.
+func setSystemPrompts(ctx context.Context, request *relaymodel.GeneralOpenAIRequest, meta *meta.Meta) (reset bool) {
+	reset = setSystemPrompt(ctx, request, meta.ForcedSystemPrompt)
+	return setTokenSystemPrompt(ctx, request, meta.TokenSystemPrompt, meta.TokenSystemPromptMode) || reset
+}
+
+// setTokenSystemPrompt applies the system prompt of the token, which replaces
+// the first system message like the one of a channel unless the token
+// prepends it.
+func setTokenSystemPrompt(ctx context.Context, request *relaymodel.GeneralOpenAIRequest, prompt string, mode string) (reset bool) {
+	if mode != model.TokenSystemPromptModePrepend {
+		return setSystemPrompt(ctx, request, prompt)
+	}
+	if prompt == "" || len(request.Messages) == 0 {
+		return false
+	}
+	request.Messages = append([]relaymodel.Message{{
+		Role:    role.System,
+		Content: prompt,
+	}}, request.Messages...)
+	logger.Infof(ctx, "prepend token system prompt")
+	return true
+}
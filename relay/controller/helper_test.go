@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestSetSystemPrompts(t *testing.T) {
+	system := func(content string) relaymodel.Message {
+		return relaymodel.Message{Role: "system", Content: content}
+	}
+	user := relaymodel.Message{Role: "user", Content: "hi"}
+	tests := []struct {
+		name     string
+		channel  string
+		token    string
+		mode     string
+		messages []relaymodel.Message
+		want     []relaymodel.Message
+	}{
+		{"none", "", "", "", []relaymodel.Message{system("request"), user}, []relaymodel.Message{system("request"), user}},
+		{"channel only", "channel", "", "", []relaymodel.Message{system("request"), user}, []relaymodel.Message{system("channel"), user}},
+		{"replace", "", "token", model.TokenSystemPromptModeReplace, []relaymodel.Message{system("request"), user}, []relaymodel.Message{system("token"), user}},
+		{"replace without system message", "", "token", "", []relaymodel.Message{user}, []relaymodel.Message{system("token"), user}},
+		{"replace with channel", "channel", "token", model.TokenSystemPromptModeReplace, []relaymodel.Message{system("request"), user}, []relaymodel.Message{system("token"), user}},
+		{"prepend", "", "token", model.TokenSystemPromptModePrepend, []relaymodel.Message{system("request"), user}, []relaymodel.Message{system("token"), system("request"), user}},
+		{"prepend with channel", "channel", "token", model.TokenSystemPromptModePrepend, []relaymodel.Message{system("request"), user}, []relaymodel.Message{system("token"), system("channel"), user}},
+		{"prepend with channel without system message", "channel", "token", model.TokenSystemPromptModePrepend, []relaymodel.Message{user}, []relaymodel.Message{system("token"), system("channel"), user}},
+	}
+	for _, tt := range tests {
+		Convey(tt.name, t, func() {
+			request := &relaymodel.GeneralOpenAIRequest{Messages: tt.messages}
+			reset := setSystemPrompts(context.Background(), request, &meta.Meta{
+				ForcedSystemPrompt:    tt.channel,
+				TokenSystemPrompt:     tt.token,
+				TokenSystemPromptMode: tt.mode,
+			})
+			So(reset, ShouldEqual, tt.channel != "" || tt.token != "")
+			So(request.Messages, ShouldResemble, tt.want)
+		})
+	}
+}
@@ -41,14 +41,6 @@ func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
 	return imageRequest, nil
 }
 
-func isValidImageSize(model string, size string) bool {
-	if model == "cogview-3" || billingratio.ImageSizeRatios[model] == nil {
-		return true
-	}
-	_, ok := billingratio.ImageSizeRatios[model][size]
-	return ok
-}
-
 func isValidImagePromptLength(model string, promptLength int) bool {
 	maxPromptLength, ok := billingratio.ImagePromptLengthLimitations[model]
 	return !ok || promptLength <= maxPromptLength
@@ -59,13 +51,6 @@ func isWithinRange(element string, value int) bool {
 	return !ok || (value >= amounts[0] && value <= amounts[1])
 }
 
-func getImageSizeRatio(model string, size string) float64 {
-	if ratio, ok := billingratio.ImageSizeRatios[model][size]; ok {
-		return ratio
-	}
-	return 1
-}
-
 func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *relaymodel.ErrorWithStatusCode {
 	// check prompt length
 	if imageRequest.Prompt == "" {
@@ -73,9 +58,15 @@ func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *
 	}
 
 	// model validation
-	if !isValidImageSize(imageRequest.Model, imageRequest.Size) {
+	if !billingratio.IsValidImageQuality(imageRequest.Model, imageRequest.Quality) {
+		return openai.ErrorWrapper(errors.New("quality not supported for this image model"), "quality_not_supported", http.StatusBadRequest)
+	}
+	if !billingratio.IsValidImageSize(imageRequest.Model, imageRequest.Size, imageRequest.Quality) {
 		return openai.ErrorWrapper(errors.New("size not supported for this image model"), "size_not_supported", http.StatusBadRequest)
 	}
+	if !billingratio.IsValidImageStyle(imageRequest.Model, imageRequest.Style) {
+		return openai.ErrorWrapper(errors.New("style not supported for this image model"), "style_not_supported", http.StatusBadRequest)
+	}
 
 	if !isValidImagePromptLength(imageRequest.Model, len(imageRequest.Prompt)) {
 		return openai.ErrorWrapper(errors.New("prompt is too long"), "prompt_too_long", http.StatusBadRequest)
@@ -92,17 +83,20 @@ func getImageCostRatio(imageRequest *relaymodel.ImageRequest) (float64, error) {
 	if imageRequest == nil {
 		return 0, errors.New("imageRequest is nil")
 	}
-	imageCostRatio := getImageSizeRatio(imageRequest.Model, imageRequest.Size)
-	if imageRequest.Quality == "hd" && imageRequest.Model == "dall-e-3" {
-		if imageRequest.Size == "1024x1024" {
-			imageCostRatio *= 2
-		} else {
-			imageCostRatio *= 1.5
-		}
-	}
+	imageCostRatio := billingratio.GetImageCostRatio(imageRequest.Model, imageRequest.Size, imageRequest.Quality, imageRequest.Style)
 	return imageCostRatio, nil
 }
 
+func getImageQuota(channelType int, ratio float64, imageCostRatio float64, n int) int64 {
+	switch channelType {
+	case channeltype.Replicate:
+		// replicate always return 1 image
+		return int64(ratio * imageCostRatio * 1000)
+	default:
+		return int64(ratio*imageCostRatio*1000) * int64(n)
+	}
+}
+
 func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatusCode {
 	ctx := c.Request.Context()
 	meta := meta.GetByContext(c)
@@ -113,9 +107,11 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 
 	// map model name
-	var isModelMapped bool
+	var isModelMapped, isTokenModelMapped bool
 	meta.OriginModelName = imageRequest.Model
+	imageRequest.Model, isTokenModelMapped = getMappedModelName(imageRequest.Model, meta.TokenModelMapping)
 	imageRequest.Model, isModelMapped = getMappedModelName(imageRequest.Model, meta.ModelMapping)
+	isModelMapped = isModelMapped || isTokenModelMapped
 	meta.ActualModelName = imageRequest.Model
 
 	// model validation
@@ -169,30 +165,31 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 
 	modelRatio := billingratio.GetModelRatio(imageModel, meta.ChannelType)
-	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	groupRatio := billingratio.GetGroupModelRatio(meta.Group, imageModel)
 	ratio := modelRatio * groupRatio
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 
-	var quota int64
-	switch meta.ChannelType {
-	case channeltype.Replicate:
-		// replicate always return 1 image
-		quota = int64(ratio * imageCostRatio * 1000)
-	default:
-		quota = int64(ratio*imageCostRatio*1000) * int64(imageRequest.N)
-	}
+	quota := getImageQuota(meta.ChannelType, ratio, imageCostRatio, imageRequest.N)
 
 	if userQuota-quota < 0 {
 		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
+	if err := model.CheckTokenBudget(meta.TokenId, quota); err != nil {
+		return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+	}
 
 	// do request
+	var usage *relaymodel.Usage
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
 	if err != nil {
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
 
+	// flushed after the quota is consumed below
+	costReport := newCostReport(c, meta)
+	defer costReport.Flush()
+
 	defer func(ctx context.Context) {
 		if resp != nil &&
 			resp.StatusCode != http.StatusCreated && // replicate returns 201
@@ -200,7 +197,22 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			return
 		}
 
-		err := model.PostConsumeTokenQuota(meta.TokenId, quota)
+		logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
+		var promptTokens, completionTokens int
+		if price := billingratio.GetImagePrice(imageModel); price != nil && price.TokenBased && usage != nil {
+			// bill the tokens reported by upstream instead of the estimate
+			textTokens, imageTokens := usage.PromptTokens, 0
+			if usage.PromptTokensDetails != nil {
+				textTokens = usage.PromptTokensDetails.TextTokens
+				imageTokens = usage.PromptTokensDetails.ImageTokens
+			}
+			completionRatio := billingratio.GetCompletionRatio(imageModel, meta.ChannelType)
+			quota = billingratio.GetImageTokenQuota(imageModel, textTokens, imageTokens, usage.CompletionTokens, ratio, completionRatio)
+			promptTokens, completionTokens = usage.PromptTokens, usage.CompletionTokens
+			logContent = fmt.Sprintf("倍率：%.2f × %.2f，补全倍率 %.2f，图片输入倍率 %.2f", modelRatio, groupRatio, completionRatio, price.ImageInputRatio)
+		}
+
+		err := model.PostConsumeTokenQuota(ctx, meta.TokenId, quota)
 		if err != nil {
 			logger.SysError("error consuming token remain quota: " + err.Error())
 		}
@@ -210,14 +222,14 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		}
 		if quota != 0 {
 			tokenName := c.GetString(ctxkey.TokenName)
-			logContent := fmt.Sprintf("倍率：%.2f × %.2f", modelRatio, groupRatio)
 			model.RecordConsumeLog(ctx, &model.Log{
 				UserId:           meta.UserId,
 				ChannelId:        meta.ChannelId,
-				PromptTokens:     0,
-				CompletionTokens: 0,
+				PromptTokens:     promptTokens,
+				CompletionTokens: completionTokens,
 				ModelName:        imageRequest.Model,
 				TokenName:        tokenName,
+				TokenId:          meta.TokenId,
 				Quota:            int(quota),
 				Content:          logContent,
 			})
@@ -225,10 +237,11 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			channelId := c.GetInt(ctxkey.ChannelId)
 			model.UpdateChannelUsedQuota(channelId, quota)
 		}
+		costReport.Report(quota, imageRequest.Model)
 	}(c.Request.Context())
 
 	// do response
-	_, respErr := adaptor.DoResponse(c, resp, meta)
+	usage, respErr := adaptor.DoResponse(c, resp, meta)
 	if respErr != nil {
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
 		return respErr
@@ -35,24 +35,31 @@ type Meta struct {
 	PromptTokens       int // only for DoResponse
 	ForcedSystemPrompt string
 	StartTime          time.Time
+	// set on the token, applied before the ones of the channel
+	TokenModelMapping     map[string]string
+	TokenSystemPrompt     string
+	TokenSystemPromptMode string
 }
 
 func GetByContext(c *gin.Context) *Meta {
 	meta := Meta{
-		Mode:               relaymode.GetByPath(c.Request.URL.Path),
-		ChannelType:        c.GetInt(ctxkey.Channel),
-		ChannelId:          c.GetInt(ctxkey.ChannelId),
-		TokenId:            c.GetInt(ctxkey.TokenId),
-		TokenName:          c.GetString(ctxkey.TokenName),
-		UserId:             c.GetInt(ctxkey.Id),
-		Group:              c.GetString(ctxkey.Group),
-		ModelMapping:       c.GetStringMapString(ctxkey.ModelMapping),
-		OriginModelName:    c.GetString(ctxkey.RequestModel),
-		BaseURL:            c.GetString(ctxkey.BaseURL),
-		APIKey:             strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
-		RequestURLPath:     c.Request.URL.String(),
-		ForcedSystemPrompt: c.GetString(ctxkey.SystemPrompt),
-		StartTime:          time.Now(),
+		Mode:                  relaymode.GetByPath(c.Request.URL.Path),
+		ChannelType:           c.GetInt(ctxkey.Channel),
+		ChannelId:             c.GetInt(ctxkey.ChannelId),
+		TokenId:               c.GetInt(ctxkey.TokenId),
+		TokenName:             c.GetString(ctxkey.TokenName),
+		UserId:                c.GetInt(ctxkey.Id),
+		Group:                 c.GetString(ctxkey.Group),
+		ModelMapping:          c.GetStringMapString(ctxkey.ModelMapping),
+		OriginModelName:       c.GetString(ctxkey.RequestModel),
+		BaseURL:               c.GetString(ctxkey.BaseURL),
+		APIKey:                strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
+		RequestURLPath:        c.Request.URL.String(),
+		ForcedSystemPrompt:    c.GetString(ctxkey.SystemPrompt),
+		StartTime:             time.Now(),
+		TokenModelMapping:     c.GetStringMapString(ctxkey.TokenModelMapping),
+		TokenSystemPrompt:     c.GetString(ctxkey.TokenSystemPrompt),
+		TokenSystemPromptMode: c.GetString(ctxkey.TokenSystemPromptMode),
 	}
 	cfg, ok := c.Get(ctxkey.Config)
 	if ok {
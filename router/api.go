@@ -4,6 +4,7 @@ import (
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/controller/auth"
 	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -29,7 +30,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), auth.WeChatAuth)
 		apiRouter.GET("/oauth/wechat/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), auth.WeChatBind)
 		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.EmailBind)
-		apiRouter.POST("/topup", middleware.AdminAuth(), controller.AdminTopUp)
+		apiRouter.POST("/topup", middleware.PermissionAuth(model.PermissionBillingWrite), controller.AdminTopUp)
 
 		userRoute := apiRouter.Group("/user")
 		{
@@ -46,43 +47,67 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.DELETE("/self", controller.DeleteSelf)
 				selfRoute.GET("/token", controller.GenerateAccessToken)
 				selfRoute.GET("/aff", controller.GetAffCode)
+				selfRoute.GET("/aff/stat", controller.GetReferralStat)
+				selfRoute.GET("/aff/commission", controller.GetUserReferralCommissions)
+				selfRoute.POST("/aff/transfer", controller.TransferAffQuota)
 				selfRoute.POST("/topup", controller.TopUp)
+				selfRoute.POST("/pay", middleware.CriticalRateLimit(), controller.RequestPayment)
+				selfRoute.GET("/order", controller.GetUserOrders)
+				selfRoute.GET("/statement", controller.GetUserLedger)
+				selfRoute.GET("/monthly_statement", controller.GetUserMonthlyStatements)
+				selfRoute.GET("/monthly_statement/:id", controller.GetUserMonthlyStatement)
 				selfRoute.GET("/available_models", controller.GetUserAvailableModels)
+				selfRoute.GET("/permission", controller.GetSelfPermissions)
 			}
 
-			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
+			userReadRoute := userRoute.Group("/")
+			userReadRoute.Use(middleware.PermissionAuth(model.PermissionUserRead))
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
+				userReadRoute.GET("/", controller.GetAllUsers)
+				userReadRoute.GET("/search", controller.SearchUsers)
+				userReadRoute.GET("/:id", controller.GetUser)
+			}
+			userManageRoute := userRoute.Group("/")
+			userManageRoute.Use(middleware.PermissionAuth(model.PermissionUserManage))
+			{
+				userManageRoute.POST("/", controller.CreateUser)
+				userManageRoute.POST("/manage", controller.ManageUser)
+				userManageRoute.PUT("/", controller.UpdateUser)
+				userManageRoute.DELETE("/:id", controller.DeleteUser)
 			}
 		}
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
 		{
-			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
+			optionRoute.GET("/", middleware.PermissionAuth(model.PermissionOptionRead), controller.GetOptions)
+			optionRoute.PUT("/", middleware.PermissionAuth(model.PermissionOptionWrite), controller.UpdateOption)
+		}
+		roleRoute := apiRouter.Group("/role")
+		roleRoute.Use(middleware.PermissionAuth(model.PermissionRoleManage))
+		{
+			roleRoute.GET("/", controller.GetAllAdminRoles)
+			roleRoute.POST("/", controller.AddAdminRole)
+			roleRoute.PUT("/", controller.UpdateAdminRole)
+			roleRoute.DELETE("/:id", controller.DeleteAdminRole)
+			roleRoute.POST("/assign", controller.AssignAdminRole)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ListAllModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.GET("/test", controller.TestChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
+			channelReadAuth := middleware.PermissionAuth(model.PermissionChannelRead)
+			channelWriteAuth := middleware.PermissionAuth(model.PermissionChannelWrite)
+			channelRoute.GET("/", channelReadAuth, controller.GetAllChannels)
+			channelRoute.GET("/search", channelReadAuth, controller.SearchChannels)
+			channelRoute.GET("/models", channelReadAuth, controller.ListAllModels)
+			channelRoute.GET("/profit", middleware.PermissionAuth(model.PermissionBillingRead), controller.GetProfitReport)
+			channelRoute.GET("/:id", channelReadAuth, controller.GetChannel)
+			channelRoute.GET("/:id/key", middleware.PermissionAuth(model.PermissionChannelKeyRead), controller.GetChannelKey)
+			channelRoute.GET("/test", channelWriteAuth, controller.TestChannels)
+			channelRoute.GET("/test/:id", channelWriteAuth, controller.TestChannel)
+			channelRoute.GET("/update_balance", channelWriteAuth, controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", channelWriteAuth, controller.UpdateChannelBalance)
+			channelRoute.POST("/", channelWriteAuth, controller.AddChannel)
+			channelRoute.PUT("/", channelWriteAuth, controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", channelWriteAuth, controller.DeleteDisabledChannel)
+			channelRoute.DELETE("/:id", channelWriteAuth, controller.DeleteChannel)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -92,28 +117,101 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.GET("/:id", controller.GetToken)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
+			tokenRoute.POST("/:id/rotate", controller.RotateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
 		{
-			redemptionRoute.GET("/", controller.GetAllRedemptions)
-			redemptionRoute.GET("/search", controller.SearchRedemptions)
-			redemptionRoute.GET("/:id", controller.GetRedemption)
-			redemptionRoute.POST("/", controller.AddRedemption)
-			redemptionRoute.PUT("/", controller.UpdateRedemption)
-			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionReadAuth := middleware.PermissionAuth(model.PermissionRedemptionRead)
+			redemptionWriteAuth := middleware.PermissionAuth(model.PermissionRedemptionWrite)
+			redemptionRoute.GET("/", redemptionReadAuth, controller.GetAllRedemptions)
+			redemptionRoute.GET("/search", redemptionReadAuth, controller.SearchRedemptions)
+			redemptionRoute.GET("/campaign", redemptionReadAuth, controller.GetRedemptionCampaignReports)
+			redemptionRoute.GET("/:id", redemptionReadAuth, controller.GetRedemption)
+			redemptionRoute.POST("/", redemptionWriteAuth, controller.AddRedemption)
+			redemptionRoute.PUT("/", redemptionWriteAuth, controller.UpdateRedemption)
+			redemptionRoute.DELETE("/:id", redemptionWriteAuth, controller.DeleteRedemption)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(model.PermissionLogRead), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(model.PermissionLogWrite), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(model.PermissionLogRead), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/search", middleware.PermissionAuth(model.PermissionLogRead), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		billingReadAuth := middleware.PermissionAuth(model.PermissionBillingRead)
+		billingWriteAuth := middleware.PermissionAuth(model.PermissionBillingWrite)
+		ledgerRoute := apiRouter.Group("/ledger")
+		{
+			ledgerRoute.GET("/", billingReadAuth, controller.GetAllLedger)
+			ledgerRoute.GET("/reconcile", billingReadAuth, controller.ReconcileLedger)
+			ledgerRoute.POST("/reconcile_quota", billingWriteAuth, controller.ReconcileQuota)
+		}
+		apiRouter.POST("/referral/settle", billingWriteAuth, controller.SettleReferralCommission)
+		apiRouter.POST("/payment/webhook/:provider", controller.PaymentWebhook)
+		orderRoute := apiRouter.Group("/order")
+		orderRoute.Use(billingReadAuth)
+		{
+			orderRoute.GET("/", controller.GetAllOrders)
+			orderRoute.GET("/:id", controller.GetOrder)
+		}
+		monthlyStatementRoute := apiRouter.Group("/monthly_statement")
+		{
+			monthlyStatementRoute.GET("/", billingReadAuth, controller.GetAllMonthlyStatements)
+			monthlyStatementRoute.GET("/group", billingReadAuth, controller.GetGroupMonthlyStatements)
+			monthlyStatementRoute.GET("/:id", billingReadAuth, controller.GetMonthlyStatement)
+			monthlyStatementRoute.POST("/generate", billingWriteAuth, controller.GenerateMonthlyStatements)
+		}
+		planRoute := apiRouter.Group("/plan")
+		{
+			planRoute.GET("/", billingReadAuth, controller.GetAllPlans)
+			planRoute.GET("/:id", billingReadAuth, controller.GetPlan)
+			planRoute.POST("/", billingWriteAuth, controller.AddPlan)
+			planRoute.PUT("/", billingWriteAuth, controller.UpdatePlan)
+			planRoute.DELETE("/:id", billingWriteAuth, controller.DeletePlan)
+			planRoute.POST("/subscribe", billingWriteAuth, controller.SubscribeUserPlan)
+			planRoute.POST("/unsubscribe", billingWriteAuth, controller.CancelUserPlan)
+		}
+		organizationRoute := apiRouter.Group("/organization")
+		organizationRoute.Use(middleware.UserAuth())
+		{
+			organizationRoute.GET("/", controller.GetUserOrganizations)
+			organizationRoute.GET("/all", middleware.PermissionAuth(model.PermissionOrganizationManage), controller.GetAllOrganizations)
+			organizationRoute.POST("/", middleware.PermissionAuth(model.PermissionOrganizationManage), controller.CreateOrganization)
+
+			viewerRoute := organizationRoute.Group("/:org_id")
+			viewerRoute.Use(middleware.OrganizationAuth(model.OrganizationRoleViewer))
+			{
+				viewerRoute.GET("/", controller.GetOrganization)
+				viewerRoute.GET("/member", controller.GetOrganizationMembers)
+				viewerRoute.DELETE("/member/:user_id", controller.DeleteOrganizationMember)
+				viewerRoute.GET("/token", controller.GetAllTokens)
+				viewerRoute.GET("/token/search", controller.SearchTokens)
+				viewerRoute.GET("/token/:id", controller.GetToken)
+				viewerRoute.GET("/log", controller.GetUserLogs)
+				viewerRoute.GET("/log/search", controller.SearchUserLogs)
+				viewerRoute.GET("/log/stat", controller.GetLogsSelfStat)
+			}
+			memberRoute := organizationRoute.Group("/:org_id")
+			memberRoute.Use(middleware.OrganizationAuth(model.OrganizationRoleMember))
+			{
+				memberRoute.POST("/quota", controller.TransferQuotaToOrganization)
+				memberRoute.POST("/token", controller.AddToken)
+				memberRoute.PUT("/token", controller.UpdateToken)
+				memberRoute.POST("/token/:id/rotate", controller.RotateToken)
+				memberRoute.DELETE("/token/:id", controller.DeleteToken)
+			}
+			adminRoute := organizationRoute.Group("/:org_id")
+			adminRoute.Use(middleware.OrganizationAuth(model.OrganizationRoleAdmin))
+			{
+				adminRoute.POST("/member", controller.AddOrganizationMember)
+				adminRoute.PUT("/member", controller.UpdateOrganizationMember)
+				adminRoute.POST("/quota/withdraw", controller.TransferQuotaFromOrganization)
+			}
+		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(model.PermissionChannelRead))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
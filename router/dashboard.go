@@ -18,5 +18,8 @@ func SetDashboardRouter(router *gin.Engine) {
 		apiRouter.GET("/v1/dashboard/billing/subscription", controller.GetSubscription)
 		apiRouter.GET("/dashboard/billing/usage", controller.GetUsage)
 		apiRouter.GET("/v1/dashboard/billing/usage", controller.GetUsage)
+		apiRouter.GET("/v1/oneapi/tokens", controller.GetChildTokens)
+		apiRouter.POST("/v1/oneapi/tokens", controller.MintChildToken)
+		apiRouter.DELETE("/v1/oneapi/tokens/:id", controller.RevokeChildToken)
 	}
 }
@@ -0,0 +1,44 @@
+import React from 'react';
+import { useTranslation } from 'react-i18next';
+import { Button, Input, Message, Modal } from 'semantic-ui-react';
+import { copy, showSuccess, showWarning } from '../helpers';
+
+// The server only keeps a hash of the key, so it is shown here once,
+// right after the token is created or rotated.
+const TokenKeyModal = ({ tokenKey, onClose }) => {
+  const { t } = useTranslation();
+  const value = `sk-${tokenKey}`;
+
+  const onCopy = async () => {
+    if (await copy(value)) {
+      showSuccess(t('token.messages.copy_success'));
+    } else {
+      showWarning(t('token.key_modal.copy_failed'));
+    }
+  };
+
+  return (
+    <Modal open={!!tokenKey} onClose={onClose} size={'small'}>
+      <Modal.Header>{t('token.key_modal.title')}</Modal.Header>
+      <Modal.Content>
+        <Message warning>{t('token.key_modal.notice')}</Message>
+        <Input
+          fluid
+          readOnly
+          value={value}
+          action={{
+            color: 'green',
+            icon: 'copy',
+            content: t('token.buttons.copy'),
+            onClick: onCopy,
+          }}
+        />
+      </Modal.Content>
+      <Modal.Actions>
+        <Button onClick={onClose}>{t('token.key_modal.close')}</Button>
+      </Modal.Actions>
+    </Modal>
+  );
+};
+
+export default TokenKeyModal;
@@ -21,6 +21,7 @@ import {
 
 import { ITEMS_PER_PAGE } from '../constants';
 import { renderQuota } from '../helpers/render';
+import TokenKeyModal from './TokenKeyModal';
 
 function renderTimestamp(timestamp) {
   return <>{timestamp2string(timestamp)}</>;
@@ -87,6 +88,7 @@ const TokensTable = () => {
   const [showTopUpModal, setShowTopUpModal] = useState(false);
   const [targetTokenIdx, setTargetTokenIdx] = useState(0);
   const [orderBy, setOrderBy] = useState('');
+  const [revealedKey, setRevealedKey] = useState('');
 
   const loadTokens = async (startIdx) => {
     const res = await API.get(`/api/token/?p=${startIdx}&order=${orderBy}`);
@@ -120,7 +122,17 @@ const TokensTable = () => {
     await loadTokens(activePage - 1);
   };
 
+  // only keys revealed by a rotation on this page are known
+  const checkKeyKnown = (key) => {
+    if (!key) {
+      showWarning(t('token.messages.key_hidden'));
+      return false;
+    }
+    return true;
+  };
+
   const onCopy = async (type, key) => {
+    if (!checkKeyKnown(key)) return;
     let status = localStorage.getItem('status');
     let serverAddress = '';
     if (status) {
@@ -169,6 +181,7 @@ const TokensTable = () => {
   };
 
   const onOpenLink = async (type, key) => {
+    if (!checkKeyKnown(key)) return;
     let status = localStorage.getItem('status');
     let serverAddress = '';
     if (status) {
@@ -234,6 +247,9 @@ const TokensTable = () => {
         data.status = 2;
         res = await API.put('/api/token/?status_only=true', data);
         break;
+      case 'rotate':
+        res = await API.post(`/api/token/${id}/rotate`);
+        break;
     }
     const { success, message } = res.data;
     if (success) {
@@ -243,6 +259,10 @@ const TokensTable = () => {
       let realIdx = (activePage - 1) * ITEMS_PER_PAGE + idx;
       if (action === 'delete') {
         newTokens[realIdx].deleted = true;
+      } else if (action === 'rotate') {
+        newTokens[realIdx].key = token.key;
+        newTokens[realIdx].key_prefix = token.key_prefix;
+        setRevealedKey(token.key);
       } else {
         newTokens[realIdx].status = token.status;
       }
@@ -334,6 +354,7 @@ const TokensTable = () => {
             >
               {t('token.table.status')}
             </Table.HeaderCell>
+            <Table.HeaderCell>{t('token.table.key')}</Table.HeaderCell>
             <Table.HeaderCell
               style={{ cursor: 'pointer' }}
               onClick={() => {
@@ -401,6 +422,9 @@ const TokensTable = () => {
                     {token.name ? token.name : t('token.table.no_name')}
                   </Table.Cell>
                   <Table.Cell>{renderStatus(token.status, t)}</Table.Cell>
+                  <Table.Cell>
+                    <code>{`sk-${token.key_prefix}...`}</code>
+                  </Table.Cell>
                   <Table.Cell>{renderQuota(token.used_quota, t)}</Table.Cell>
                   <Table.Cell>
                     {token.unlimited_quota
@@ -465,6 +489,26 @@ const TokensTable = () => {
                           {t('token.buttons.confirm_delete')} {token.name}
                         </Button>
                       </Popup>
+                      <Popup
+                        trigger={
+                          <Button size='tiny'>
+                            {t('token.buttons.rotate')}
+                          </Button>
+                        }
+                        on='click'
+                        flowing
+                        hoverable
+                      >
+                        <Button
+                          size={'tiny'}
+                          color='orange'
+                          onClick={() => {
+                            manageToken(token.id, 'rotate', idx);
+                          }}
+                        >
+                          {t('token.buttons.confirm_rotate')} {token.name}
+                        </Button>
+                      </Popup>
                       <Button
                         size={'tiny'}
                         onClick={() => {
@@ -495,7 +539,7 @@ const TokensTable = () => {
 
         <Table.Footer>
           <Table.Row>
-            <Table.HeaderCell colSpan='7'>
+            <Table.HeaderCell colSpan='8'>
               <Button size='small' as={Link} to='/token/add' loading={loading}>
                 {t('token.buttons.add')}
               </Button>
@@ -537,6 +581,10 @@ const TokensTable = () => {
           </Table.Row>
         </Table.Footer>
       </Table>
+      <TokenKeyModal
+        tokenKey={revealedKey}
+        onClose={() => setRevealedKey('')}
+      />
     </>
   );
 };
@@ -17,6 +17,7 @@ import {
   timestamp2string,
 } from '../../helpers';
 import { renderQuotaWithPrompt } from '../../helpers/render';
+import TokenKeyModal from '../../components/TokenKeyModal';
 
 const EditToken = () => {
   const { t } = useTranslation();
@@ -34,6 +35,7 @@ const EditToken = () => {
     subnet: '',
   };
   const [inputs, setInputs] = useState(originInputs);
+  const [createdKey, setCreatedKey] = useState('');
   const { name, remain_quota, expired_time, unlimited_quota } = inputs;
   const navigate = useNavigate();
   const handleInputChange = (e, { name, value }) => {
@@ -139,13 +141,14 @@ const EditToken = () => {
     } else {
       res = await API.post(`/api/token/`, localInputs);
     }
-    const { success, message } = res.data;
+    const { success, message, data } = res.data;
     if (success) {
       if (isEdit) {
         showSuccess(t('token.edit.messages.update_success'));
       } else {
         showSuccess(t('token.edit.messages.create_success'));
         setInputs(originInputs);
+        setCreatedKey(data.key);
       }
     } else {
       showError(message);
@@ -287,6 +290,7 @@ const EditToken = () => {
           </Form>
         </Card.Content>
       </Card>
+      <TokenKeyModal tokenKey={createdKey} onClose={() => setCreatedKey('')} />
     </div>
   );
 };